@@ -0,0 +1,312 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/im-kulikov/go-bones/logger"
+	"github.com/im-kulikov/go-bones/service"
+	"go.uber.org/zap"
+
+	"github.com/im-kulikov/docker-dns/internal/broadcast"
+)
+
+const (
+	// addressListBatchSize flushes pending changes without waiting for batch delay.
+	addressListBatchSize = 100
+
+	// addressListTTL used when update message has no TTL.
+	addressListTTL = time.Minute * 10
+)
+
+// AddressList mirrors resolved addresses into RouterOS firewall address
+// list, it's an alternative to BGP broadcaster.
+type AddressList interface {
+	broadcast.Broadcaster
+	service.Service
+}
+
+type addressList struct {
+	service.Service
+
+	cfg RouterConfig
+	cli *client
+	log logger.Logger
+
+	// dty notifies that desired state was changed
+	dty chan struct{}
+
+	// desired state, updates are coalesced, so Broadcast never blocks
+	mu      sync.Mutex
+	active  map[string]struct{}
+	ttl     time.Duration
+	pending int
+
+	// entries of the address list by address, accessed from Run loop only,
+	// nil means that entries should be fetched from RouterOS
+	entries map[string]AddressListEntry
+}
+
+var _ AddressList = (*addressList)(nil)
+
+// NewAddressList creates RouterOS address list sink for resolved domains.
+func NewAddressList(cfg RouterConfig, log logger.Logger) (AddressList, error) {
+	cli, err := cfg.prepareClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not prepare RouterOS client: %w", err)
+	}
+
+	cli.setLogger(log)
+
+	svc := addressList{
+		cfg: cfg,
+		cli: cli,
+		log: log,
+		dty: make(chan struct{}, 1),
+
+		active: make(map[string]struct{}),
+		ttl:    addressListTTL,
+	}
+
+	svc.Service = service.NewWorker("routeros-address-list", svc.Run)
+
+	return &svc, nil
+}
+
+// Broadcast applies update to desired state of the address list, empty messages
+// refresh timeouts. It never blocks, so unreachable RouterOS doesn't stall callers.
+func (a *addressList) Broadcast(msg broadcast.UpdateMessage) {
+	a.mu.Lock()
+	a.apply(msg)
+	a.mu.Unlock()
+
+	select {
+	case a.dty <- struct{}{}:
+	default:
+	}
+}
+
+func (a *addressList) apply(msg broadcast.UpdateMessage) {
+	a.pending += len(msg.ToUpdate) + len(msg.ToRemove)
+
+	for _, address := range msg.ToRemove {
+		delete(a.active, address)
+	}
+
+	for _, address := range msg.ToUpdate {
+		a.active[address] = struct{}{}
+	}
+
+	if msg.TTL > 0 {
+		a.ttl = msg.TTL
+	}
+}
+
+// desired returns copy of desired addresses and timeout of entries, that covers
+// two update intervals, so entries don't expire while the next resolve is in progress.
+func (a *addressList) desired() (map[string]struct{}, string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	out := make(map[string]struct{}, len(a.active))
+	for address := range a.active {
+		out[address] = struct{}{}
+	}
+
+	a.pending = 0
+
+	return out, strconv.FormatInt(int64(2*a.ttl/time.Second), 10)
+}
+
+// changes returns number of changes since the last flush.
+func (a *addressList) changes() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.pending
+}
+
+// fetch reads entries, that are owned by docker-dns, and removes duplicates.
+func (a *addressList) fetch(ctx context.Context) error {
+	var owned []AddressListEntry
+	err := routerRequest(ctx, a.cfg.Timeout, func(ctx context.Context) (err error) {
+		owned, err = a.cli.AddressList(ctx, a.cfg.AddressList, a.cfg.Tag)
+
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not fetch RouterOS address list: %w", err)
+	}
+
+	var duplicates []string
+
+	entries := make(map[string]AddressListEntry, len(owned))
+	for _, item := range owned {
+		if _, ok := entries[item.Address]; ok {
+			duplicates = append(duplicates, item.ID)
+
+			continue
+		}
+
+		entries[item.Address] = item
+	}
+
+	if len(duplicates) > 0 {
+		if err = routerRequest(ctx, a.cfg.Timeout, func(ctx context.Context) error {
+			return a.cli.RemoveAddresses(ctx, duplicates...)
+		}); err != nil {
+			return fmt.Errorf("could not remove RouterOS address list duplicates: %w", err)
+		}
+	}
+
+	a.entries = entries
+
+	return nil
+}
+
+// flush reconciles address list: adds missing, refreshes timeouts of
+// existing and removes stale entries, that are owned by docker-dns.
+// Entries are cached between flushes and fetched again after an error.
+func (a *addressList) flush(ctx context.Context) error {
+	if a.entries == nil {
+		if err := a.fetch(ctx); err != nil {
+			return err
+		}
+	}
+
+	active, timeout := a.desired()
+
+	if err := a.reconcile(ctx, active, timeout); err != nil {
+		a.entries = nil
+
+		return err
+	}
+
+	return nil
+}
+
+func (a *addressList) reconcile(ctx context.Context, active map[string]struct{}, timeout string) error {
+	var (
+		err     error
+		stale   []string
+		refresh []string
+	)
+
+	for address, item := range a.entries {
+		if _, ok := active[address]; !ok {
+			stale = append(stale, item.ID)
+
+			continue
+		}
+
+		refresh = append(refresh, item.ID)
+	}
+
+	if len(refresh) > 0 {
+		if err = routerRequest(ctx, a.cfg.Timeout, func(ctx context.Context) error {
+			return a.cli.RefreshAddresses(ctx, timeout, refresh...)
+		}); err != nil {
+			return fmt.Errorf("could not refresh RouterOS address list: %w", err)
+		}
+	}
+
+	if len(stale) > 0 {
+		if err = routerRequest(ctx, a.cfg.Timeout, func(ctx context.Context) error {
+			return a.cli.RemoveAddresses(ctx, stale...)
+		}); err != nil {
+			return fmt.Errorf("could not remove RouterOS address list entries: %w", err)
+		}
+	}
+
+	for address := range a.entries {
+		if _, ok := active[address]; !ok {
+			delete(a.entries, address)
+		}
+	}
+
+	var added int
+	for address := range active {
+		if _, ok := a.entries[address]; ok {
+			continue
+		}
+
+		entry := AddressListEntry{
+			List:    a.cfg.AddressList,
+			Address: address,
+			Timeout: timeout,
+			Comment: a.cfg.Tag,
+		}
+
+		if err = routerRequest(ctx, a.cfg.Timeout, func(ctx context.Context) (err error) {
+			entry.ID, err = a.cli.AddAddress(ctx, entry)
+
+			return err
+		}); err != nil {
+			return fmt.Errorf("could not add %s to RouterOS address list: %w", address, err)
+		}
+
+		a.entries[address] = entry
+		added++
+	}
+
+	a.log.Infow("RouterOS address list reconciled",
+		zap.String("list", a.cfg.AddressList),
+		zap.String("timeout", timeout),
+		zap.Int("added", added),
+		zap.Int("refreshed", len(refresh)),
+		zap.Int("removed", len(stale)))
+
+	return nil
+}
+
+func (a *addressList) Run(ctx context.Context) error {
+	// nothing is flushed until the first update, it carries every
+	// resolved address, so previously created entries are reconciled
+	if !waitFor(ctx, a.log, "RouterOS API", func() error { return a.fetch(ctx) }) {
+		return nil
+	}
+
+	timer := time.NewTimer(a.cfg.BatchDelay)
+	defer timer.Stop()
+
+	if !timer.Stop() {
+		<-timer.C
+	}
+
+	var pending bool
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-a.dty:
+			if !pending {
+				pending = true
+
+				timer.Reset(a.cfg.BatchDelay)
+			}
+
+			if a.changes() < addressListBatchSize {
+				continue
+			}
+
+			if !timer.Stop() {
+				<-timer.C
+			}
+		case <-timer.C:
+		}
+
+		if err := a.flush(ctx); err != nil {
+			a.log.Warnw("could not update RouterOS address list", zap.Error(err))
+
+			// retry with the next batch
+			timer.Reset(a.cfg.BatchDelay)
+
+			continue
+		}
+
+		pending = false
+	}
+}
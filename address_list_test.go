@@ -0,0 +1,143 @@
+package dns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/im-kulikov/go-bones/logger"
+
+	"github.com/im-kulikov/docker-dns/internal/broadcast"
+)
+
+// fakeAddressList is RouterOS REST API of firewall address list.
+type fakeAddressList struct {
+	sync.Mutex
+
+	fail    bool
+	prints  int
+	last    int
+	entries map[string]AddressListEntry
+}
+
+func (f *fakeAddressList) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	args := make(map[string]string)
+	_ = json.NewDecoder(r.Body).Decode(&args)
+
+	switch r.URL.Path {
+	case cmdAddressList:
+		f.prints++
+
+		out := make([]AddressListEntry, 0, len(f.entries))
+		for _, entry := range f.entries {
+			out = append(out, entry)
+		}
+
+		_ = json.NewEncoder(w).Encode(out)
+	case cmdAddressAdd:
+		f.last++
+
+		id := "*" + strconv.Itoa(f.last)
+		f.entries[id] = AddressListEntry{
+			ID:      id,
+			List:    args["list"],
+			Address: args["address"],
+			Timeout: args["timeout"],
+			Comment: args["comment"],
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]string{"ret": id})
+	case cmdAddressSet:
+		if f.fail {
+			http.Error(w, "no such item", http.StatusBadRequest)
+
+			return
+		}
+
+		_, _ = w.Write([]byte("[]"))
+	case cmdAddressRemove:
+		delete(f.entries, args[".id"])
+
+		_, _ = w.Write([]byte("[]"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestAddressListFlush(t *testing.T) {
+	api := &fakeAddressList{entries: map[string]AddressListEntry{
+		"*a": {ID: "*a", List: "docker-dns", Address: "10.0.0.9", Comment: "docker-dns"},
+		"*b": {ID: "*b", List: "other", Address: "10.0.0.9", Comment: "docker-dns"},
+	}}
+
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	cfg := RouterConfig{
+		Address:     srv.URL,
+		Username:    "admin",
+		Password:    "admin",
+		Tag:         "docker-dns",
+		AddressList: "docker-dns",
+		Timeout:     time.Second,
+	}
+
+	out, err := NewAddressList(cfg, logger.ForTests(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lst := out.(*addressList)
+
+	// Run is not started, updates are coalesced without blocking
+	for i := 0; i < 1000; i++ {
+		lst.Broadcast(broadcast.UpdateMessage{ToUpdate: []string{"10.0.0.1"}, ToRemove: []string{"10.0.0.2"}})
+	}
+
+	lst.Broadcast(broadcast.UpdateMessage{ToUpdate: []string{"10.0.0.2"}})
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err = lst.flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if api.prints != 1 {
+		t.Fatalf("expected address list to be fetched once, got %d", api.prints)
+	}
+
+	addresses := make(map[string]string)
+	for _, entry := range api.entries {
+		if entry.List == "docker-dns" {
+			addresses[entry.Address] = entry.Timeout
+		}
+	}
+
+	if len(addresses) != 2 || addresses["10.0.0.1"] == "" || addresses["10.0.0.2"] == "" {
+		t.Fatalf("expected 10.0.0.1 and 10.0.0.2, got %v", api.entries)
+	} else if _, ok := api.entries["*b"]; !ok {
+		t.Fatal("entry of another list should not be removed")
+	}
+
+	// entries are fetched again after an error
+	api.fail = true
+	if err = lst.flush(ctx); err == nil {
+		t.Fatal("expected error")
+	}
+
+	api.fail = false
+	if err = lst.flush(ctx); err != nil {
+		t.Fatal(err)
+	} else if api.prints != 2 {
+		t.Fatalf("expected address list to be fetched again, got %d", api.prints)
+	}
+}
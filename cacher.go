@@ -5,9 +5,9 @@ import (
 	"net"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/docker/docker/libnetwork/netutils"
-	docker "github.com/fsouza/go-dockerclient"
 	"github.com/im-kulikov/go-bones/logger"
 	"github.com/im-kulikov/go-bones/service"
 	"github.com/miekg/dns"
@@ -19,13 +19,6 @@ type Cacher interface {
 	Set(dns.Question, string, []dns.RR)
 }
 
-type DockerListener interface {
-	DockerClient
-
-	Ping() error
-	AddEventListener(chan<- *docker.APIEvents) error
-}
-
 type CacheWorker interface {
 	Cacher
 
@@ -35,75 +28,56 @@ type CacheWorker interface {
 type cache struct {
 	service.Service
 
-	cli DockerClient
+	cli ContainerSource
 	log logger.Logger
-	out chan *docker.APIEvents
-
-	sync.RWMutex
-	rec map[dns.Question][]dns.RR
-	cnr map[string][]dns.Question
+	out chan *Event
+	lbl []string
+	hlt bool
+	sub string
+
+	// dty notifies that snapshot should be persisted
+	dty chan struct{}
+	snp *snapshot
+
+	// stl are owners restored from snapshot with their expiry time, they are
+	// withdrawn after ttl unless reconciled with container backend and never
+	// written back to snapshot, mu serializes both
+	mu  sync.Mutex
+	stl map[string]time.Time
+	ttl time.Duration
+	exp *time.Timer
+
+	*recordStore
 }
 
-func NewCache(cli DockerListener, log logger.Logger) (CacheWorker, error) {
-	if err := cli.Ping(); err != nil {
-		return nil, err
-	}
-
-	out := make(chan *docker.APIEvents)
-	if err := cli.AddEventListener(out); err != nil {
-		return nil, err
-	}
-
+func NewCache(cfg Config, host DockerHostConfig, cli ContainerSource, log logger.Logger) (CacheWorker, error) {
 	svc := cache{
 		cli: cli,
 		log: log,
-		out: out,
-		cnr: make(map[string][]dns.Question),
-		rec: make(map[dns.Question][]dns.RR),
-	}
-
-	svc.Service = service.NewWorker("docker-dns-cache", svc.Run)
-
-	return &svc, nil
-}
-
-func (c *cache) Get(query dns.Question) ([]dns.RR, error) {
-	c.RLock()
-	defer c.RUnlock()
-
-	if rec, ok := c.rec[query]; ok {
-		msg := new(dns.Msg)
-		msg.Answer = rec
-
-		c.log.Debugw("found record in cache",
-			Query(query).Fields()...)
-
-		return msg.Copy().Answer, nil
+		out: make(chan *Event),
+		dty: make(chan struct{}, 1),
+		snp: newSnapshot(cfg.SnapshotDir, host.Name),
+		ttl: cfg.SnapshotStale,
+		lbl: cfg.Labels,
+		hlt: cfg.HealthyOnly,
+		sub: host.Subdomain,
+
+		recordStore: newRecordStore(log),
 	}
 
-	return nil, ErrNotFound
-}
-
-func (c *cache) Set(query dns.Question, cid string, rec []dns.RR) {
-	c.Lock()
-	defer c.Unlock()
-
-	msg := new(dns.Msg)
-	msg.Answer = rec
-
-	c.rec[query] = msg.Copy().Answer
-
-	if _, ok := c.cnr[cid]; !ok {
-		c.cnr[cid] = make([]dns.Question, 0)
+	if err := svc.restore(); err != nil {
+		log.Warnw("could not restore records snapshot",
+			zap.String("snapshot", svc.snp.path),
+			zap.Error(err))
 	}
 
-	c.cnr[cid] = append(c.cnr[cid], query)
+	svc.subscribe(svc.changed)
+	svc.Service = service.NewWorker("docker-dns-cache-"+host.Name, svc.Run)
 
-	c.log.Debugw("added record to cache",
-		Query(query).Fields()...)
+	return &svc, nil
 }
 
-func (c *cache) handleStart(event *docker.APIEvents) {
+func (c *cache) handleStart(event *Event) {
 	container, err := c.cli.InspectContainer(event.ID)
 	if err != nil {
 		c.log.Warnw("could not inspect container",
@@ -113,10 +87,23 @@ func (c *cache) handleStart(event *docker.APIEvents) {
 		return
 	}
 
-	if strings.Count(container.Config.Hostname, ".") < 1 {
+	if strings.Count(container.Hostname, ".") < 1 {
 		c.log.Warnw("ignoring container with invalid hostname",
 			zap.String("container", container.ID),
-			zap.String("hostname", container.Config.Hostname))
+			zap.String("hostname", container.Hostname))
+
+		// records could be restored from snapshot or published before rename
+		c.remove(container.ID)
+
+		return
+	}
+
+	if !isPublishable(container, c.hlt) {
+		c.log.Infow("withdraw records of unhealthy container",
+			zap.String("container", container.ID),
+			zap.String("health", container.Health))
+
+		c.handleDie(event)
 
 		return
 	}
@@ -127,82 +114,142 @@ func (c *cache) handleStart(event *docker.APIEvents) {
 			zap.String("container", container.ID),
 			zap.Error(err))
 
+		c.remove(container.ID)
+
 		return
 	}
 
-	c.Set(dns.Question{
-		Name:   container.Config.Hostname + ".",
-		Qtype:  dns.TypeA,
-		Qclass: dns.ClassINET,
-	}, container.ID, []dns.RR{
-		&dns.A{
-			Hdr: dns.RR_Header{
-				Name:   container.Config.Hostname + ".",
-				Rrtype: dns.TypeA,
-				Class:  dns.ClassINET,
-				Ttl:    3600,
+	hostname := containerName(container, c.sub)
+
+	names := []string{hostname}
+	if isWildcard(container) {
+		names = append(names, wildcardName(names[0]))
+	}
+
+	var records []dns.RR
+	for _, name := range names {
+		records = append(records,
+			&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   name,
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+					Ttl:    3600,
+				},
+				A: ipaddr,
 			},
-			A: ipaddr,
-		},
-	})
+			containerTXT(name, container, c.lbl))
+	}
+
+	for _, alias := range containerAliases(container) {
+		records = append(records, aliasCNAME(alias, hostname))
+	}
 
 	revip := netutils.ReverseIP(ipaddr.String())
 
-	c.Set(dns.Question{
-		Name:   revip + ".in-addr.arpa.",
-		Qtype:  dns.TypePTR,
-		Qclass: dns.ClassINET,
-	}, container.ID, []dns.RR{
-		&dns.PTR{
-			Ptr: revip + ".in-addr.arpa.",
-			Hdr: dns.RR_Header{
-				Name:   container.Config.Hostname + ".",
-				Rrtype: dns.TypeA,
-				Class:  dns.ClassINET,
-				Ttl:    3600,
-			},
+	records = append(records, &dns.PTR{
+		Ptr: hostname,
+		Hdr: dns.RR_Header{
+			Name:   revip + ".in-addr.arpa.",
+			Rrtype: dns.TypePTR,
+			Class:  dns.ClassINET,
+			Ttl:    3600,
 		},
 	})
+
+	// replace keeps record set of the container consistent,
+	// when it's restarted with another address
+	c.replace(container.ID, groupRecords(records))
 }
 
-func (c *cache) handleDie(event *docker.APIEvents) {
-	c.Lock()
-	defer c.Unlock()
+func (c *cache) handleDie(event *Event) { c.remove(event.ID) }
 
-	if queries, ok := c.cnr[event.ID]; ok {
-		for _, query := range queries {
-			if _, exists := c.rec[query]; !exists {
-				continue
-			}
+func (c *cache) handleEvent(event *Event) {
+	switch event.Action {
+	case "start":
+		c.handleStart(event)
+	case "destroy", "die":
+		c.handleDie(event)
+	case eventReconnect:
+		c.reconcile()
+	default:
+		// health_status events publish or withdraw records
+		if isHealthEvent(event.Action) {
+			c.handleStart(event)
+		}
+	}
+}
 
-			delete(c.rec, query)
+func (c *cache) changed() {
+	select {
+	case c.dty <- struct{}{}:
+	default:
+	}
+}
 
-			c.log.Debugw("removed record from cache",
-				Query(query).Fields(
-					zap.String("container", event.ID),
-					zap.String("hostname", query.Name))...)
+// connect waits until container backend is reachable and subscribes to events.
+func (c *cache) connect(ctx context.Context) bool {
+	return waitFor(ctx, c.log, "container backend", func() error {
+		if err := c.cli.Ping(ctx); err != nil {
+			return err
 		}
-	}
 
-	delete(c.cnr, event.ID)
+		return c.cli.AddEventListener(ctx, c.out)
+	})
 }
 
-func (c *cache) handleEvent(event *docker.APIEvents) {
-	switch event.Action {
-	case "start":
-		c.handleStart(event)
-	case "destroy", "die":
-		c.handleDie(event)
+// reconcile publishes running containers and withdraws records
+// of containers, that were stopped while we were offline.
+func (c *cache) reconcile() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ids, err := c.cli.ListContainers()
+	if err != nil {
+		c.log.Warnw("could not list containers for reconcile", zap.Error(err))
+
+		return
 	}
+
+	alive := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		alive[id] = struct{}{}
+
+		c.handleStart(&Event{ID: id, Type: "container", Action: "start"})
+	}
+
+	for _, oid := range c.owners() {
+		if _, ok := alive[oid]; !ok {
+			c.remove(oid)
+		}
+	}
+
+	if c.exp != nil {
+		c.exp.Stop()
+	}
+
+	if len(c.stl) > 0 {
+		c.log.Infow("stale records reconciled", zap.Int("containers", len(ids)))
+	}
+
+	c.stl = nil
 }
 
 func (c *cache) Run(ctx context.Context) error {
+	if !c.connect(ctx) {
+		return nil
+	}
+
+	c.reconcile()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
 		case event := <-c.out:
 			c.handleEvent(event)
+		case <-c.dty:
+			c.persist()
 		}
 	}
 }
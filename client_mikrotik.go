@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	"net/url"
 	"strings"
@@ -16,8 +15,18 @@ import (
 )
 
 const (
-	cmdList = "/rest/ip/dns/static/print"
-	cmdSet  = "/rest/ip/dns/static/set"
+	routerRetryDelay = time.Millisecond * 500
+	routerErrorLimit = 1024
+
+	cmdList   = "/rest/ip/dns/static/print"
+	cmdAdd    = "/rest/ip/dns/static/add"
+	cmdSet    = "/rest/ip/dns/static/set"
+	cmdRemove = "/rest/ip/dns/static/remove"
+
+	cmdAddressList   = "/rest/ip/firewall/address-list/print"
+	cmdAddressAdd    = "/rest/ip/firewall/address-list/add"
+	cmdAddressSet    = "/rest/ip/firewall/address-list/set"
+	cmdAddressRemove = "/rest/ip/firewall/address-list/remove"
 )
 
 type CallParam struct {
@@ -32,6 +41,9 @@ type client struct {
 
 	username string
 	password string
+
+	// retries of failed requests (network errors and 5xx responses)
+	retries int
 }
 
 func closeIt(log logger.Logger, closer io.Closer) {
@@ -79,9 +91,11 @@ func (r *client) request(ctx context.Context, cmd string, args ...CallParam) (*h
 		r.uri.JoinPath(cmd).String(), out))
 }
 
-type StaticDNSListResponse []struct {
+// StaticDNSRecord is an entry of RouterOS static DNS.
+type StaticDNSRecord struct {
 	ID             string `json:".id"`
 	Address        string `json:"address,omitempty"`
+	CNAME          string `json:"cname,omitempty"`
 	Disabled       string `json:"disabled"`
 	Dynamic        string `json:"dynamic"`
 	Name           string `json:"name,omitempty"`
@@ -93,108 +107,163 @@ type StaticDNSListResponse []struct {
 	MatchSubdomain string `json:"match-subdomain,omitempty"`
 }
 
-func (r *client) List(ctx context.Context) ([]string, error) {
+type StaticDNSListResponse []StaticDNSRecord
+
+// idempotent returns false for commands, that create entries, they're not
+// retried, because failed response doesn't mean that entry wasn't created.
+func idempotent(cmd string) bool { return cmd != cmdAdd && cmd != cmdAddressAdd }
+
+// call executes RouterOS command and decodes response into out, when it's not nil.
+// Failed idempotent requests are retried with linear backoff.
+func (r *client) call(ctx context.Context, cmd string, out any, args ...CallParam) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		if retry, err = r.try(ctx, cmd, out, args...); !retry || !idempotent(cmd) || attempt >= r.retries {
+			return err
+		}
+
+		r.log.Debugf("retrying RouterOS command %s (attempt %d): %s", cmd, attempt+1, err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(routerRetryDelay * time.Duration(attempt+1)):
+		}
+	}
+}
+
+// try executes RouterOS command once, returns true when request could be retried.
+func (r *client) try(ctx context.Context, cmd string, out any, args ...CallParam) (bool, error) {
 	var res *http.Response
-	if req, err := r.request(ctx, cmdList); err != nil {
-		return nil, err
+	if req, err := r.request(ctx, cmd, args...); err != nil {
+		return false, err
 	} else if res, err = r.cli.Do(req); err != nil {
-		return nil, err
+		return ctx.Err() == nil, err
 	}
 
 	defer r.closeBody(res.Body)
 	if res.StatusCode < http.StatusOK || res.StatusCode > http.StatusMultipleChoices {
-		out, _ := io.ReadAll(res.Body)
+		out, _ := io.ReadAll(io.LimitReader(res.Body, routerErrorLimit))
 
-		return nil, fmt.Errorf("HTTP Error: %d\n%s", res.StatusCode, string(out))
+		return res.StatusCode >= http.StatusInternalServerError,
+			fmt.Errorf("HTTP Error: %d\n%s", res.StatusCode, string(out))
 	}
 
-	buf := new(bytes.Buffer)
-	tee := io.TeeReader(res.Body, buf)
+	if out == nil {
+		return false, nil
+	}
 
+	// response body is not logged, it could contain sensitive data
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return false, fmt.Errorf("JSON Decode Error: %w", err)
+	}
+
+	return false, nil
+}
+
+// List returns static DNS entries, that are tagged by passed comment.
+func (r *client) List(ctx context.Context, tag string) ([]StaticDNSRecord, error) {
 	var tmp StaticDNSListResponse
-	if err := json.NewDecoder(tee).Decode(&tmp); err != nil {
-		return nil, fmt.Errorf("JSON Decode Error: %w\n%s", err, buf.String())
+	if err := r.call(ctx, cmdList, &tmp); err != nil {
+		return nil, err
 	}
 
-	items := make([]string, 0, len(tmp))
+	items := make([]StaticDNSRecord, 0, len(tmp))
 	for _, item := range tmp {
-		if item.Comment != "local-dns" {
+		if item.Comment != tag || item.Dynamic == "true" {
 			continue
 		}
 
-		items = append(items, item.ID)
+		items = append(items, item)
 	}
 
 	return items, nil
 }
 
-func (r *client) Set(ctx context.Context, ids []string, address string) error {
+func staticParams(rec StaticDNSRecord) []CallParam {
 	args := []CallParam{
-		{Key: ".id", Val: strings.Join(ids, ",")},
-		{Key: "forward-to", Val: address},
+		{Key: "name", Val: rec.Name},
+		{Key: "type", Val: rec.Type},
+		{Key: "ttl", Val: rec.TTL},
+		{Key: "comment", Val: rec.Comment},
 	}
 
-	var res *http.Response
-	if req, err := r.request(ctx, cmdSet, args...); err != nil {
-		return err
-	} else if res, err = r.cli.Do(req); err != nil {
-		return err
+	if rec.Type == "CNAME" {
+		return append(args, CallParam{Key: "cname", Val: rec.CNAME})
 	}
 
-	defer r.closeBody(res.Body)
-	if res.StatusCode < http.StatusOK || res.StatusCode > http.StatusMultipleChoices {
-		out, _ := io.ReadAll(res.Body)
-
-		return fmt.Errorf("HTTP Error: %d\n%s", res.StatusCode, string(out))
-	}
-
-	return nil
+	return append(args, CallParam{Key: "address", Val: rec.Address})
 }
 
-func localIP(log logger.Logger) net.IP {
-	conn, err := net.Dial("udp", "8.8.8.8:80")
-	if err != nil {
-		log.Fatalf("could not fetch local address: %s", err)
-	}
-
-	defer closeIt(log, conn)
+// Add creates static DNS entry.
+func (r *client) Add(ctx context.Context, rec StaticDNSRecord) error {
+	return r.call(ctx, cmdAdd, nil, staticParams(rec)...)
+}
 
-	localAddress := conn.LocalAddr().(*net.UDPAddr)
+// Set updates static DNS entry with passed identifier.
+func (r *client) Set(ctx context.Context, id string, rec StaticDNSRecord) error {
+	return r.call(ctx, cmdSet, nil, append(staticParams(rec), CallParam{Key: ".id", Val: id})...)
+}
 
-	return localAddress.IP
+// Remove deletes static DNS entries with passed identifiers.
+func (r *client) Remove(ctx context.Context, ids ...string) error {
+	return r.call(ctx, cmdRemove, nil, CallParam{Key: ".id", Val: strings.Join(ids, ",")})
 }
 
-func UpdateStaticDNS(top context.Context, log logger.Logger, cfg RouterConfig) error {
-	var err error
-	if !cfg.Enabled {
-		log.Info("RouterOS API disabled")
+// AddressListEntry is an entry of RouterOS firewall address list.
+type AddressListEntry struct {
+	ID       string `json:".id"`
+	List     string `json:"list"`
+	Address  string `json:"address"`
+	Timeout  string `json:"timeout,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+	Disabled string `json:"disabled"`
+	Dynamic  string `json:"dynamic"`
+}
 
-		return nil
+// AddressList returns entries of the address list, that are tagged by passed comment.
+func (r *client) AddressList(ctx context.Context, list, tag string) ([]AddressListEntry, error) {
+	var tmp []AddressListEntry
+	if err := r.call(ctx, cmdAddressList, &tmp); err != nil {
+		return nil, err
 	}
 
-	var cli *client
-	if cli, err = cfg.prepareClient(); err != nil {
-		return fmt.Errorf("could not prepare RouterOS client: %w", err)
+	items := make([]AddressListEntry, 0, len(tmp))
+	for _, item := range tmp {
+		if item.List != list || item.Comment != tag {
+			continue
+		}
+
+		items = append(items, item)
 	}
 
-	ctx, cancel := context.WithTimeout(top, time.Second)
-	defer cancel()
+	return items, nil
+}
 
-	var ids []string
-	if ids, err = cli.List(ctx); err != nil {
-		return fmt.Errorf("could not fetch router OS static DNS: %w", err)
+// AddAddress creates entry of the address list, returns its identifier.
+func (r *client) AddAddress(ctx context.Context, entry AddressListEntry) (string, error) {
+	var out struct {
+		ID string `json:"ret"`
 	}
 
-	log.Infof("RouterOS API fetched %d static DNS records", len(ids))
-
-	local := localIP(log).String()
+	err := r.call(ctx, cmdAddressAdd, &out,
+		CallParam{Key: "list", Val: entry.List},
+		CallParam{Key: "address", Val: entry.Address},
+		CallParam{Key: "timeout", Val: entry.Timeout},
+		CallParam{Key: "comment", Val: entry.Comment})
 
-	if err = cli.Set(ctx, ids, local); err != nil {
-		return fmt.Errorf("could not update router OS static DNS: %w", err)
-	}
+	return out.ID, err
+}
 
-	log.Infof("RouterOS API updated %d static DNS records forward-to: %s",
-		len(ids), local)
+// RefreshAddresses updates timeout of address list entries with passed identifiers.
+func (r *client) RefreshAddresses(ctx context.Context, timeout string, ids ...string) error {
+	return r.call(ctx, cmdAddressSet, nil,
+		CallParam{Key: ".id", Val: strings.Join(ids, ",")},
+		CallParam{Key: "timeout", Val: timeout})
+}
 
-	return nil
+// RemoveAddresses deletes address list entries with passed identifiers.
+func (r *client) RemoveAddresses(ctx context.Context, ids ...string) error {
+	return r.call(ctx, cmdAddressRemove, nil, CallParam{Key: ".id", Val: strings.Join(ids, ",")})
 }
@@ -0,0 +1,48 @@
+package dns
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClientRetriesIdempotentOnly(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls = make(map[string]int)
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls[r.URL.Path]++
+		mu.Unlock()
+
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	cli, err := RouterConfig{Address: srv.URL, Username: "admin", Retries: 1, Timeout: time.Second}.prepareClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err = cli.AddressList(ctx, "docker-dns", "docker-dns"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if _, err = cli.AddAddress(ctx, AddressListEntry{Address: "10.0.0.1"}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if err = cli.Add(ctx, StaticDNSRecord{Name: "web.lan", Type: "A", Address: "10.0.0.1"}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if calls[cmdAddressList] != 2 || calls[cmdAddressAdd] != 1 || calls[cmdAdd] != 1 {
+		t.Fatalf("expected print to be retried and add not, got %v", calls)
+	}
+}
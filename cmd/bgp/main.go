@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	dockerdns "github.com/im-kulikov/docker-dns"
 	"github.com/im-kulikov/docker-dns/internal/admin"
 	"github.com/im-kulikov/docker-dns/internal/bgp"
 	"github.com/im-kulikov/docker-dns/internal/broadcast"
@@ -21,6 +22,9 @@ type settings struct {
 	BGP bgp.Config     `env:"BGP"`
 	DNS dns.Config     `env:"DNS"`
 	Web web.HTTPConfig `env:"ADMIN"`
+
+	// Router mirrors resolved addresses into RouterOS address list
+	Router dockerdns.RouterConfig `env:"ROUTER"`
 }
 
 func options(cfg settings, services ...service.Service) []service.Option {
@@ -53,8 +57,21 @@ func main() {
 	// prepare broadcaster
 	brd := broadcast.New(cfg.BGP.Attributes, log)
 
+	services := []service.Service{brd}
+	sinks := broadcast.Fanout{brd}
+
+	if cfg.Router.Enabled {
+		var lst dockerdns.AddressList
+		if lst, err = dockerdns.NewAddressList(cfg.Router, log.Named("routeros")); err != nil {
+			log.Panicw("could not create address list service", zap.Error(err))
+		}
+
+		sinks = append(sinks, lst)
+		services = append(services, lst)
+	}
+
 	var svc dns.Interface
-	if svc, err = dns.New(cfg.DNS, log, brd); err != nil {
+	if svc, err = dns.New(cfg.DNS, log, sinks); err != nil {
 		log.Panicw("could not create dns service", zap.Error(err))
 	}
 
@@ -63,9 +80,10 @@ func main() {
 		log.Panicw("could not create bgp service", zap.Error(err))
 	}
 
-	adm := admin.New(cfg.Web, log, svc)
+	adm := admin.New(cfg.Web, log, svc, brd)
 	ops := web.NewOpsServer(log, cfg.Base.Ops)
-	if err = service.New(log, options(cfg, adm, brd, svc, srv, ops)...).Run(ctx); err != nil {
+	services = append(services, adm, svc, srv, ops)
+	if err = service.New(log, options(cfg, services...)...).Run(ctx); err != nil {
 		log.Panicw("could not create service runner", zap.Error(err))
 	}
 }
@@ -5,7 +5,6 @@ import (
 	"os/signal"
 	"syscall"
 
-	docker "github.com/fsouza/go-dockerclient"
 	"github.com/im-kulikov/go-bones/config"
 	"github.com/im-kulikov/go-bones/logger"
 	"github.com/im-kulikov/go-bones/service"
@@ -20,6 +19,7 @@ type settings struct {
 
 	DNS dns.Config       `env:"DNS"`
 	API dns.RouterConfig `env:"ROUTER"`
+	K8S dns.KubeConfig   `env:"K8S"`
 }
 
 var (
@@ -33,6 +33,14 @@ func (c settings) Validate(ctx context.Context) error {
 		return err
 	}
 
+	if err := c.K8S.Validate(ctx); err != nil {
+		return err
+	}
+
+	if err := c.API.Validate(ctx); err != nil {
+		return err
+	}
+
 	return c.Base.Validate(ctx)
 }
 
@@ -59,32 +67,63 @@ func main() {
 		log.Fatalf("could not initialize tracer: %s", err)
 	}
 
-	var cli *docker.Client
-	if cli, err = docker.NewClientFromEnv(); err != nil {
-		log.Fatalf("could not initialize docker client: %s", err)
+	var hosts []*dns.Host
+	if hosts, err = dns.NewHosts(cfg.DNS, log); err != nil {
+		log.Fatalf("could not initialize docker hosts: %s", err)
 	}
 
-	svc := dns.NewServer(cfg.DNS, cli, log)
-	ops := web.NewOpsServer(log, cfg.Base.Ops)
-
-	var wrk dns.CacheWorker
-	if wrk, err = dns.NewCache(cli, log); err != nil {
-		log.Fatalf("could not initialize cache: %s", err)
+	checkers := make([]web.HealthChecker, 0, len(hosts))
+	for _, host := range hosts {
+		checkers = append(checkers, host)
 	}
 
-	svc.SetCache(wrk)
+	svc := dns.NewServer(cfg.DNS, log, hosts...)
+	ops := web.NewOpsServer(log, cfg.Base.Ops, checkers...)
 
-	group := service.New(log,
+	opts := []service.Option{
 		service.WithService(svc),
 		service.WithService(ops),
-		service.WithService(wrk),
 		service.WithService(trace),
-		service.WithShutdownTimeout(cfg.Base.Shutdown))
+		service.WithShutdownTimeout(cfg.Base.Shutdown),
+	}
 
-	if err = dns.UpdateStaticDNS(ctx, log, cfg.API); err != nil {
-		log.Fatalf("could not update DNS: %s", err)
+	for _, host := range hosts {
+		for _, wrk := range host.Workers() {
+			opts = append(opts, service.WithService(wrk))
+		}
 	}
 
+	if cfg.DNS.Update.Enabled {
+		var upd service.Service
+		if upd, err = dns.NewUpdater(cfg.DNS.Update, log.Named("update"), hosts...); err != nil {
+			log.Fatalf("could not initialize dynamic update: %s", err)
+		}
+
+		opts = append(opts, service.WithService(upd))
+	}
+
+	if cfg.K8S.Enabled {
+		var kube dns.CacheWorker
+		if kube, err = dns.NewKubeCache(cfg.K8S, log.Named("k8s")); err != nil {
+			log.Fatalf("could not initialize kubernetes cache: %s", err)
+		}
+
+		svc.SetCache(kube)
+
+		opts = append(opts, service.WithService(kube))
+	}
+
+	if cfg.API.Enabled {
+		var api service.Service
+		if api, err = dns.NewRouterSync(cfg.API, log.Named("routeros"), hosts...); err != nil {
+			log.Fatalf("could not initialize RouterOS static DNS: %s", err)
+		}
+
+		opts = append(opts, service.WithService(api))
+	}
+
+	group := service.New(log, opts...)
+
 	if err = group.Run(context.Background()); err != nil {
 		log.Fatalf("something went wrong: %s", err)
 	}
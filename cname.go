@@ -0,0 +1,185 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+const (
+	// labelAliases contains comma separated CNAME aliases of the container.
+	labelAliases = "docker-dns.aliases"
+
+	// maxCNAMEChain limits the length of CNAME chain that could be chased.
+	maxCNAMEChain = 8
+)
+
+// containerAliases returns FQDN aliases declared through container labels.
+func containerAliases(container *Container) []string {
+	val, ok := container.Labels[labelAliases]
+	if !ok {
+		return nil
+	}
+
+	var out []string
+	for _, alias := range strings.Split(val, ",") {
+		if alias = strings.TrimSpace(alias); alias == "" {
+			continue
+		}
+
+		out = append(out, dns.Fqdn(strings.ToLower(alias)))
+	}
+
+	return out
+}
+
+func aliasCNAME(alias, target string) *dns.CNAME {
+	return &dns.CNAME{
+		Hdr: dns.RR_Header{
+			Name:   alias,
+			Rrtype: dns.TypeCNAME,
+			Class:  dns.ClassINET,
+			Ttl:    3600,
+		},
+		Target: target,
+	}
+}
+
+func (d *dockerStore) fetchAlias(query dns.Question) ([]dns.RR, error) {
+	containers, err := d.client.ListContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []dns.RR
+	for _, cid := range containers {
+		var item *Container
+		if item, err = d.client.InspectContainer(cid); err != nil {
+			d.logger.Warnw("could not inspect container",
+				zap.String("container", cid),
+				zap.Error(err))
+
+			continue
+		}
+
+		if !isPublishable(item, d.health) {
+			continue
+		}
+
+		for _, alias := range containerAliases(item) {
+			if alias != query.Name {
+				continue
+			}
+
+			rec := []dns.RR{aliasCNAME(alias, containerName(item, d.subdomain))}
+
+			d.cacheResult(query, cid, rec)
+
+			out = append(out, rec...)
+		}
+	}
+
+	if len(out) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return out, nil
+}
+
+// pickCNAME returns single CNAME from the RRset, replicas of the same service
+// share the alias, so the lowest target is chosen to keep answers stable.
+func pickCNAME(records []dns.RR) (*dns.CNAME, bool) {
+	var list []*dns.CNAME
+	for _, rr := range records {
+		if cname, ok := rr.(*dns.CNAME); ok {
+			list = append(list, cname)
+		}
+	}
+
+	if len(list) == 0 {
+		return nil, false
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Target < list[j].Target })
+
+	return list[0], true
+}
+
+// chase resolves the query, following CNAME aliases with loop detection.
+// Result contains CNAME chain followed by records of the final target,
+// targets, that are not known locally, are resolved by upstream.
+func (s *server) chase(query dns.Question) ([]dns.RR, error) {
+	var out []dns.RR
+
+	seen := make(map[string]struct{}, maxCNAMEChain)
+	for depth := 0; ; depth++ {
+		// too long chains are treated as loops too
+		if _, ok := seen[query.Name]; ok || depth >= maxCNAMEChain {
+			return nil, fmt.Errorf("%s: %w", query.Name, ErrCNAMELoop)
+		}
+
+		seen[query.Name] = struct{}{}
+
+		rec, err := s.stores.Get(query)
+		if err == nil && len(rec) > 0 {
+			return append(out, rec...), nil
+		} else if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+
+		if query.Qtype == dns.TypeCNAME {
+			break
+		}
+
+		if rec, err = s.stores.Get(dns.Question{
+			Name:   query.Name,
+			Qtype:  dns.TypeCNAME,
+			Qclass: query.Qclass,
+		}); err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+
+		cname, ok := pickCNAME(rec)
+		if !ok {
+			break
+		}
+
+		s.logger.Debugw("chasing alias",
+			Query(query).Fields(zap.String("target", cname.Target))...)
+
+		out = append(out, cname)
+		query.Name = cname.Target
+	}
+
+	if len(out) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return append(out, s.forward(query)...), nil
+}
+
+// forward resolves external target of the chain by upstream resolver,
+// chain only is answered, when upstream doesn't know the target.
+func (s *server) forward(query dns.Question) []dns.RR {
+	req := new(dns.Msg)
+	req.SetQuestion(query.Name, query.Qtype)
+
+	res, err := s.exchange(req)
+	if err != nil {
+		s.logger.Warnw("could not resolve alias target",
+			Query(query).Fields(zap.Error(err))...)
+
+		return nil
+	} else if res.Rcode != dns.RcodeSuccess {
+		s.logger.Debugw("alias target is not resolved",
+			Query(query).Fields(zap.String("rcode", dns.RcodeToString[res.Rcode]))...)
+
+		return nil
+	}
+
+	return res.Answer
+}
@@ -0,0 +1,95 @@
+package dns
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/im-kulikov/go-bones/logger"
+	"github.com/miekg/dns"
+)
+
+// newTestUpstream starts resolver, that knows ext.example.com only.
+func newTestUpstream(t *testing.T) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		reply := new(dns.Msg)
+		reply.SetReply(req)
+
+		if q := req.Question[0]; q.Name == "ext.example.com." && q.Qtype == dns.TypeA {
+			reply.Answer = []dns.RR{testA(q.Name, "192.0.2.1")}
+		} else {
+			reply.SetRcode(req, dns.RcodeNameError)
+		}
+
+		_ = w.WriteMsg(reply)
+	})}
+
+	go func() { _ = srv.ActivateAndServe() }()
+
+	t.Cleanup(func() { _ = srv.Shutdown() })
+
+	return conn.LocalAddr().String()
+}
+
+func TestChase(t *testing.T) {
+	cache := newRecordStore(logger.ForTests(t))
+	cache.Set(testQuestion("web.lan.", dns.TypeA), "web", []dns.RR{testA("web.lan.", "10.0.0.1")})
+	cache.Set(testQuestion("www.lan.", dns.TypeCNAME), "www", []dns.RR{aliasCNAME("www.lan.", "web.lan.")})
+	cache.Set(testQuestion("cdn.lan.", dns.TypeCNAME), "cdn", []dns.RR{aliasCNAME("cdn.lan.", "www.lan.")})
+	cache.Set(testQuestion("*.wild.lan.", dns.TypeCNAME), "wild", []dns.RR{aliasCNAME("*.wild.lan.", "web.lan.")})
+	cache.Set(testQuestion("a.lan.", dns.TypeCNAME), "a", []dns.RR{aliasCNAME("a.lan.", "b.lan.")})
+	cache.Set(testQuestion("b.lan.", dns.TypeCNAME), "b", []dns.RR{aliasCNAME("b.lan.", "a.lan.")})
+	cache.Set(testQuestion("dangling.lan.", dns.TypeCNAME), "dangling", []dns.RR{aliasCNAME("dangling.lan.", "none.lan.")})
+	cache.Set(testQuestion("ext.lan.", dns.TypeCNAME), "ext", []dns.RR{aliasCNAME("ext.lan.", "ext.example.com.")})
+	cache.Set(testQuestion("gone.lan.", dns.TypeCNAME), "gone", []dns.RR{aliasCNAME("gone.lan.", "gone.example.com.")})
+
+	srv := &server{stores: cache, logger: logger.ForTests(t), upstream: newTestUpstream(t)}
+
+	cases := []struct {
+		name  string
+		query dns.Question
+		want  []string
+		err   error
+	}{
+		{name: "direct", query: testQuestion("web.lan.", dns.TypeA), want: []string{"web.lan. A"}},
+		{name: "alias", query: testQuestion("www.lan.", dns.TypeA), want: []string{"www.lan. CNAME", "web.lan. A"}},
+		{name: "chain", query: testQuestion("cdn.lan.", dns.TypeA), want: []string{"cdn.lan. CNAME", "www.lan. CNAME", "web.lan. A"}},
+		{name: "wildcard alias", query: testQuestion("x.wild.lan.", dns.TypeA), want: []string{"x.wild.lan. CNAME", "web.lan. A"}},
+		{name: "cname query", query: testQuestion("www.lan.", dns.TypeCNAME), want: []string{"www.lan. CNAME"}},
+		{name: "dangling", query: testQuestion("dangling.lan.", dns.TypeA), want: []string{"dangling.lan. CNAME"}},
+		{name: "external", query: testQuestion("ext.lan.", dns.TypeA), want: []string{"ext.lan. CNAME", "ext.example.com. A"}},
+		{name: "dangling external", query: testQuestion("gone.lan.", dns.TypeA), want: []string{"gone.lan. CNAME"}},
+		{name: "loop", query: testQuestion("a.lan.", dns.TypeA), err: ErrCNAMELoop},
+		{name: "missing", query: testQuestion("none.lan.", dns.TypeA), err: ErrNotFound},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec, err := srv.chase(tc.query)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("expected %v, got %v (%v)", tc.err, err, rec)
+				}
+
+				return
+			}
+
+			if err != nil || len(rec) != len(tc.want) {
+				t.Fatalf("expected %v, got %v (%v)", tc.want, rec, err)
+			}
+
+			for i, rr := range rec {
+				if got := rr.Header().Name + " " + dns.TypeToString[rr.Header().Rrtype]; got != tc.want[i] {
+					t.Fatalf("expected %s at %d, got %s", tc.want[i], i, got)
+				}
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net"
 	"syscall"
+	"time"
 
 	"golang.org/x/sys/unix"
 )
@@ -11,6 +12,31 @@ import (
 type Config struct {
 	Address string `env:"ADDRESS" default:":53"`
 	Network string `env:"NETWORK" default:"udp"`
+
+	// Labels is an allow-list of container labels exposed through TXT records.
+	Labels []string `env:"TXT_LABELS" default:""`
+
+	// HealthyOnly publishes containers with healthcheck only when they are healthy.
+	HealthyOnly bool `env:"HEALTHY_ONLY" default:"false"`
+
+	// Hosts is a list of Docker daemons, see DockerHostConfig for the format.
+	Hosts []string `env:"DOCKER_HOSTS" default:""`
+
+	// Swarm enables records of Swarm services and tasks under SwarmZone.
+	Swarm     bool   `env:"SWARM" default:"false"`
+	SwarmZone string `env:"SWARM_ZONE" default:"docker.lan"`
+
+	// SnapshotDir enables persisting of container records, so they are
+	// served (as stale) on startup before Docker is reachable. Stale records
+	// are withdrawn, when Docker is not reachable within SnapshotStale.
+	SnapshotDir   string        `env:"SNAPSHOT_DIR" default:""`
+	SnapshotStale time.Duration `env:"SNAPSHOT_STALE" default:"10m"`
+
+	// Transfer allows secondaries to transfer container records as a zone.
+	Transfer TransferConfig `env:"TRANSFER"`
+
+	// Update pushes container records to an external primary (RFC 2136).
+	Update UpdateConfig `env:"UPDATE"`
 }
 
 func control(network, address string, c syscall.RawConn) (err error) {
@@ -28,6 +54,14 @@ func control(network, address string, c syscall.RawConn) (err error) {
 }
 
 func (c Config) Validate(ctx context.Context) error {
+	if err := c.Transfer.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Update.Validate(ctx); err != nil {
+		return err
+	}
+
 	var lc net.ListenConfig
 
 	lc.Control = control
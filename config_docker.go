@@ -0,0 +1,157 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/im-kulikov/go-bones/logger"
+)
+
+// DockerHostConfig describes single container host used as records source.
+//
+// It's parsed from string like:
+//
+//	name=edge;endpoint=tcp://10.0.0.2:2376;tls=/etc/docker/edge;subdomain=edge
+//	name=pods;backend=podman;endpoint=unix:///run/podman/podman.sock
+//	name=ctrd;backend=containerd;endpoint=/var/lib/cni/results;state=/var/lib/nerdctl
+//
+// Supported Docker endpoints are unix://, tcp:// (with optional TLS) and ssh://.
+// ssh:// endpoints run external ssh client, that is missing in the official
+// (scratch) image, so they require an image with ssh installed.
+// Empty endpoint means that Docker client should be configured from environment.
+// For containerd backend endpoint is a path to CNI results cache and state is
+// a path to nerdctl data store.
+type DockerHostConfig struct {
+	Name      string
+	Backend   string
+	Endpoint  string
+	CertPath  string
+	StatePath string
+	Subdomain string
+}
+
+const (
+	defaultHostName = "local"
+
+	BackendDocker     = "docker"
+	BackendPodman     = "podman"
+	BackendContainerd = "containerd"
+)
+
+// ParseDockerHosts parses list of Docker hosts, empty list means single
+// host configured from environment (DOCKER_HOST and friends).
+func ParseDockerHosts(list []string) ([]DockerHostConfig, error) {
+	out := make([]DockerHostConfig, 0, len(list))
+	for _, item := range list {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		host := DockerHostConfig{Backend: BackendDocker}
+		for _, pair := range strings.Split(item, ";") {
+			key, val, ok := strings.Cut(pair, "=")
+			if !ok {
+				return nil, fmt.Errorf("docker host %q: invalid option %q", item, pair)
+			}
+
+			switch val = strings.TrimSpace(val); strings.TrimSpace(key) {
+			case "name":
+				host.Name = val
+			case "endpoint":
+				host.Endpoint = val
+			case "backend":
+				host.Backend = val
+			case "tls":
+				host.CertPath = val
+			case "state":
+				host.StatePath = val
+			case "subdomain":
+				host.Subdomain = strings.Trim(val, ".")
+			default:
+				return nil, fmt.Errorf("docker host %q: unknown option %q", item, key)
+			}
+		}
+
+		if err := host.Validate(context.Background()); err != nil {
+			return nil, err
+		}
+
+		out = append(out, host)
+	}
+
+	if len(out) == 0 {
+		out = append(out, DockerHostConfig{Name: defaultHostName, Backend: BackendDocker})
+	}
+
+	return out, nil
+}
+
+func (c DockerHostConfig) Validate(_ context.Context) error {
+	switch {
+	case c.Name == "":
+		return errors.New("empty docker host name")
+	case c.Backend != BackendDocker && c.Backend != BackendPodman && c.Backend != BackendContainerd:
+		return fmt.Errorf("docker host %s: unknown backend %q", c.Name, c.Backend)
+	case c.Backend == BackendPodman && c.Endpoint == "":
+		return fmt.Errorf("docker host %s: podman requires endpoint", c.Name)
+	case c.Endpoint == "" && c.CertPath != "":
+		return fmt.Errorf("docker host %s: TLS requires endpoint", c.Name)
+	case strings.HasPrefix(c.Endpoint, "ssh://") && !sshAvailable():
+		return fmt.Errorf("docker host %s: ssh:// endpoint requires ssh client in PATH, "+
+			"it's not available in the official image", c.Name)
+	default:
+		return nil
+	}
+}
+
+func (c DockerHostConfig) prepareSource(log logger.Logger) (ContainerSource, error) {
+	switch c.Backend {
+	case BackendPodman:
+		return newPodmanSource(c.Endpoint, log)
+	case BackendContainerd:
+		return newContainerdSource(c.Endpoint, c.StatePath, log), nil
+	default:
+		cli, err := c.prepareClient()
+		if err != nil {
+			return nil, err
+		}
+
+		return newDockerSource(cli, log), nil
+	}
+}
+
+func (c DockerHostConfig) prepareClient() (*docker.Client, error) {
+	if c.Endpoint == "" {
+		return docker.NewClientFromEnv()
+	}
+
+	uri, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case uri.Scheme == "ssh":
+		var cli *docker.Client
+		// socket path is ignored, every connection is dialed through ssh
+		if cli, err = docker.NewClient("unix:///var/run/docker.sock"); err != nil {
+			return nil, err
+		}
+
+		cli.Dialer = newSSHDialer(uri)
+
+		return cli, nil
+	case c.CertPath != "":
+		return docker.NewTLSClient(c.Endpoint,
+			filepath.Join(c.CertPath, "cert.pem"),
+			filepath.Join(c.CertPath, "key.pem"),
+			filepath.Join(c.CertPath, "ca.pem"))
+	default:
+		return docker.NewClient(c.Endpoint)
+	}
+}
@@ -0,0 +1,38 @@
+package dns
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestParseDockerHostsSSH(t *testing.T) {
+	defer func(fn func(string) (string, error)) { lookPath = fn }(lookPath)
+
+	cases := []struct {
+		name  string
+		found bool
+		item  string
+		fails bool
+	}{
+		{name: "ssh with client", found: true, item: "name=edge;endpoint=ssh://root@10.0.0.2"},
+		{name: "ssh without client", item: "name=edge;endpoint=ssh://root@10.0.0.2", fails: true},
+		{name: "tcp without client", item: "name=edge;endpoint=tcp://10.0.0.2:2375"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			lookPath = func(string) (string, error) {
+				if tc.found {
+					return "/usr/bin/ssh", nil
+				}
+
+				return "", exec.ErrNotFound
+			}
+
+			_, err := ParseDockerHosts([]string{tc.item})
+			if tc.fails != (err != nil) {
+				t.Fatalf("expected failure %t, got %v", tc.fails, err)
+			}
+		})
+	}
+}
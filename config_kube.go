@@ -0,0 +1,93 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// KubeConfig allows to publish Kubernetes services (k3s, kind, etc.).
+type KubeConfig struct {
+	Enabled   bool          `env:"ENABLED" default:"false"`
+	Address   string        `env:"ADDRESS" default:"https://127.0.0.1:6443"`
+	Zone      string        `env:"ZONE" default:"k8s.lan"`
+	Token     string        `env:"TOKEN" default:""`
+	TokenFile string        `env:"TOKEN_FILE" default:""`
+	CAFile    string        `env:"CA_FILE" default:""`
+	CertFile  string        `env:"CERT_FILE" default:""`
+	KeyFile   string        `env:"KEY_FILE" default:""`
+	Insecure  bool          `env:"INSECURE" default:"false"`
+	Timeout   time.Duration `env:"TIMEOUT" default:"10s"`
+}
+
+func (c KubeConfig) Validate(_ context.Context) error {
+	if !c.Enabled {
+		return nil
+	}
+
+	switch uri, err := url.Parse(c.Address); {
+	case err != nil:
+		return fmt.Errorf("invalid Kubernetes API address: %w", err)
+	case uri.Scheme != "http" && uri.Scheme != "https":
+		return fmt.Errorf("invalid Kubernetes API address scheme %q", uri.Scheme)
+	case strings.Trim(c.Zone, ".") == "":
+		return errors.New("empty Kubernetes zone")
+	case (c.CertFile == "") != (c.KeyFile == ""):
+		return errors.New("both Kubernetes client certificate and key are required")
+	default:
+		return nil
+	}
+}
+
+func (c KubeConfig) token() (string, error) {
+	if c.Token != "" || c.TokenFile == "" {
+		return c.Token, nil
+	}
+
+	buf, err := os.ReadFile(c.TokenFile)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(buf)), nil
+}
+
+// prepareClient returns HTTP client for the API server, watch requests are
+// long-living, so timeout is applied per request through context.
+func (c KubeConfig) prepareClient() (*http.Client, error) {
+	// #nosec G402 -- insecure mode must be explicitly enabled
+	conf := &tls.Config{InsecureSkipVerify: c.Insecure, MinVersion: tls.VersionTLS12}
+
+	if c.CAFile != "" {
+		buf, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(buf) {
+			return nil, fmt.Errorf("could not parse Kubernetes CA bundle %s", c.CAFile)
+		}
+	}
+
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = conf
+
+	return &http.Client{Transport: transport}, nil
+}
@@ -2,48 +2,211 @@ package dns
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/im-kulikov/go-bones/logger"
 )
 
 // RouterConfig allows to configure RouterOS (Mikrotik) static DNS.
+// Address without scheme is accessed over HTTP.
 type RouterConfig struct {
 	Address  string `env:"ADDRESS" default:"192.168.88.1"`
 	Enabled  bool   `env:"ENABLED" default:"false"`
 	Username string `env:"USERNAME" default:"admin"`
 	Password string `env:"PASSWORD" default:"admin"`
+
+	// CAFile is a bundle to verify router certificate, Fingerprint pins
+	// SHA-256 of the router leaf certificate (hex, colons are allowed).
+	// Both are used with https:// address only.
+	CAFile      string `env:"CA_FILE" default:""`
+	Fingerprint string `env:"FINGERPRINT" default:""`
+	Insecure    bool   `env:"INSECURE" default:"false"`
+
+	Timeout time.Duration `env:"TIMEOUT" default:"10s"`
+	Retries int           `env:"RETRIES" default:"3"`
+
+	// Tag is a comment of static DNS entries owned by docker-dns,
+	// entries with another comment are never touched.
+	Tag string `env:"TAG" default:"docker-dns"`
+
+	// Interval of drift reconciliation.
+	Interval time.Duration `env:"INTERVAL" default:"5m"`
+
+	// AddressList is a firewall address list, that mirrors resolved addresses.
+	AddressList string        `env:"ADDRESS_LIST" default:"docker-dns"`
+	BatchDelay  time.Duration `env:"BATCH_DELAY" default:"2s"`
 }
 
 func (c RouterConfig) Validate(_ context.Context) error {
 	switch {
+	case !c.Enabled:
+		return nil
 	case c.Address == "":
 		return errors.New("empty RouterOS address")
 	case c.Username == "":
 		return errors.New("empty RouterOS username")
 	case c.Password == "":
 		return errors.New("empty RouterOS password")
-	default:
-		return nil
+	case c.Tag == "":
+		return errors.New("empty RouterOS static DNS tag")
+	case c.Interval <= 0:
+		return errors.New("RouterOS reconcile interval should be positive")
+	case c.Timeout <= 0:
+		return errors.New("RouterOS timeout should be positive")
+	case c.Retries < 0:
+		return errors.New("RouterOS retries should not be negative")
+	}
+
+	uri, err := c.address()
+	if err != nil {
+		return fmt.Errorf("invalid RouterOS address: %w", err)
+	}
+
+	if uri.Scheme != "http" && uri.Scheme != "https" {
+		return fmt.Errorf("invalid RouterOS address scheme %q", uri.Scheme)
+	}
+
+	if _, err = c.fingerprint(); err != nil {
+		return fmt.Errorf("invalid RouterOS certificate fingerprint: %w", err)
+	}
+
+	return nil
+}
+
+func (c RouterConfig) address() (*url.URL, error) {
+	address := c.Address
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+
+	return url.Parse(address)
+}
+
+func (c RouterConfig) fingerprint() ([]byte, error) {
+	if c.Fingerprint == "" {
+		return nil, nil
+	}
+
+	out, err := hex.DecodeString(strings.ReplaceAll(c.Fingerprint, ":", ""))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(out) != sha256.Size {
+		return nil, fmt.Errorf("expected %d bytes, got %d", sha256.Size, len(out))
 	}
+
+	return out, nil
+}
+
+// verifyPinned checks, that router leaf certificate matches pinned fingerprint.
+// Other certificates of the chain are sent by peer and must not be trusted.
+// When roots are passed, chain is verified by them too.
+func verifyPinned(pin []byte, roots *x509.CertPool, host string) func([][]byte, [][]*x509.Certificate) error {
+	return func(certs [][]byte, _ [][]*x509.Certificate) error {
+		if len(certs) == 0 {
+			return errors.New("RouterOS certificate is missing")
+		}
+
+		if sum := sha256.Sum256(certs[0]); subtle.ConstantTimeCompare(sum[:], pin) != 1 {
+			return errors.New("RouterOS certificate does not match pinned fingerprint")
+		}
+
+		if roots == nil {
+			return nil
+		}
+
+		chain := make([]*x509.Certificate, 0, len(certs))
+		for _, raw := range certs {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return fmt.Errorf("could not parse RouterOS certificate: %w", err)
+			}
+
+			chain = append(chain, cert)
+		}
+
+		opts := x509.VerifyOptions{Roots: roots, DNSName: host, Intermediates: x509.NewCertPool()}
+		for _, cert := range chain[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+
+		_, err := chain[0].Verify(opts)
+
+		return err
+	}
+}
+
+// prepareTransport returns transport, that verifies router certificate by
+// custom CA bundle and/or pinned fingerprint.
+func (c RouterConfig) prepareTransport(host string) (*http.Transport, error) {
+	pin, err := c.fingerprint()
+	if err != nil {
+		return nil, err
+	}
+
+	// #nosec G402 -- insecure mode must be explicitly enabled, pinned certificate is verified manually
+	conf := &tls.Config{InsecureSkipVerify: c.Insecure || pin != nil, MinVersion: tls.VersionTLS12}
+
+	if c.CAFile != "" {
+		buf, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(buf) {
+			return nil, fmt.Errorf("could not parse RouterOS CA bundle %s", c.CAFile)
+		}
+	}
+
+	if pin != nil {
+		conf.VerifyPeerCertificate = verifyPinned(pin, conf.RootCAs, host)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = conf
+
+	return transport, nil
 }
 
 func (c RouterConfig) prepareClient() (*client, error) {
-	uri, err := url.Parse(c.Address)
+	uri, err := c.address()
 	if err != nil {
 		return nil, err
 	}
 
-	uri.Scheme = "http"
+	username, password := c.Username, c.Password
+	if uri.User != nil {
+		// credentials must not leak into logs and errors with the address
+		username = uri.User.Username()
+		password, _ = uri.User.Password()
+		uri.User = nil
+	}
+
+	var transport *http.Transport
+	if transport, err = c.prepareTransport(uri.Hostname()); err != nil {
+		return nil, err
+	}
 
 	return &client{
-		username: c.Username,
-		password: c.Password,
+		username: username,
+		password: password,
+		retries:  c.Retries,
 
 		uri: uri,
-		cli: &http.Client{},
+		cli: &http.Client{Transport: transport, Timeout: c.Timeout},
 		log: logger.Default(),
 	}, nil
 }
@@ -0,0 +1,94 @@
+package dns
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// testCertificate returns self-signed certificate of 127.0.0.1.
+func testCertificate(t *testing.T, name string) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+func TestVerifyPinned(t *testing.T) {
+	leaf := testCertificate(t, "router")
+	other := testCertificate(t, "attacker")
+	pin := sha256.Sum256(leaf.Raw)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+
+	cases := []struct {
+		name  string
+		certs [][]byte
+		roots *x509.CertPool
+		fail  bool
+	}{
+		{name: "leaf", certs: [][]byte{leaf.Raw}},
+		{name: "empty", fail: true},
+		{name: "another leaf", certs: [][]byte{other.Raw}, fail: true},
+		{name: "pinned in chain", certs: [][]byte{other.Raw, leaf.Raw}, fail: true},
+		{name: "leaf and roots", certs: [][]byte{leaf.Raw}, roots: roots},
+		{name: "leaf of another ca", certs: [][]byte{leaf.Raw}, roots: x509.NewCertPool(), fail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := verifyPinned(pin[:], tc.roots, "127.0.0.1")(tc.certs, nil)
+			if tc.fail != (err != nil) {
+				t.Fatalf("expected failure %t, got %v", tc.fail, err)
+			}
+		})
+	}
+}
+
+func TestRouterAddress(t *testing.T) {
+	cases := map[string]string{
+		"192.168.88.1":         "http://192.168.88.1",
+		"https://192.168.88.1": "https://192.168.88.1",
+	}
+
+	for address, want := range cases {
+		uri, err := RouterConfig{Address: address}.address()
+		if err != nil || uri.String() != want {
+			t.Fatalf("expected %s, got %v (%v)", want, uri, err)
+		}
+	}
+}
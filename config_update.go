@@ -0,0 +1,90 @@
+package dns
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// UpdateConfig allows to push container records to an external
+// authoritative server using dynamic updates (RFC 2136).
+type UpdateConfig struct {
+	Enabled bool   `env:"ENABLED" default:"false"`
+	Primary string `env:"PRIMARY" default:""`
+	Network string `env:"NETWORK" default:"tcp"`
+
+	// Zones are forward and reverse zones, records are sent to the closest one.
+	Zones []string `env:"ZONES" default:""`
+
+	// Owner is written to TXT record next to every pushed name, so records
+	// left after restart could be found by zone transfer and removed.
+	// Pushed names are exclusive, A, AAAA and PTR records of other writers
+	// at these names are removed on full sync.
+	Owner string `env:"OWNER" default:"docker-dns"`
+
+	TSIGName      string `env:"TSIG_NAME" default:""`
+	TSIGSecret    string `env:"TSIG_SECRET" default:""`
+	TSIGAlgorithm string `env:"TSIG_ALGORITHM" default:"hmac-sha256."`
+
+	Timeout  time.Duration `env:"TIMEOUT" default:"5s"`
+	Interval time.Duration `env:"INTERVAL" default:"5m"`
+}
+
+func (c UpdateConfig) Validate(_ context.Context) error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if _, _, err := net.SplitHostPort(c.Primary); err != nil {
+		return fmt.Errorf("invalid dynamic update primary: %w", err)
+	}
+
+	if len(c.zones()) == 0 {
+		return errors.New("empty dynamic update zones")
+	}
+
+	if c.Owner == "" {
+		return errors.New("empty dynamic update owner")
+	}
+
+	if c.Interval <= 0 {
+		return errors.New("dynamic update reconcile interval should be positive")
+	}
+
+	if c.TSIGName == "" {
+		return nil
+	}
+
+	if _, err := base64.StdEncoding.DecodeString(c.TSIGSecret); err != nil {
+		return fmt.Errorf("dynamic update tsig secret: %w", err)
+	}
+
+	return nil
+}
+
+func (c UpdateConfig) zones() []string {
+	out := make([]string, 0, len(c.Zones))
+	for _, zone := range c.Zones {
+		if zone = strings.TrimSpace(zone); strings.Trim(zone, ".") != "" {
+			out = append(out, strings.ToLower(zoneFqdn(zone)))
+		}
+	}
+
+	return out
+}
+
+func (c UpdateConfig) tsigSecrets() map[string]string {
+	if c.TSIGName == "" {
+		return nil
+	}
+
+	return map[string]string{dns.CanonicalName(c.TSIGName): c.TSIGSecret}
+}
+
+func zoneFqdn(zone string) string { return strings.TrimSuffix(zone, ".") + "." }
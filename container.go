@@ -0,0 +1,68 @@
+package dns
+
+import (
+	"context"
+	"net"
+)
+
+// Container is a backend-neutral model of container, that used to build records.
+type Container struct {
+	ID       string
+	Name     string
+	Image    string
+	Hostname string
+	Health   string
+	Labels   map[string]string
+
+	// Addresses contains IPv4 addresses of the container, primary first.
+	Addresses []net.IP
+}
+
+// Event is a backend-neutral container lifecycle event.
+type Event struct {
+	ID         string
+	Type       string
+	Action     string
+	Attributes map[string]string
+}
+
+// eventReconnect is sent by source when events stream was re-established,
+// events could be lost meanwhile, so containers should be reconciled.
+const eventReconnect = "reconnect"
+
+// ContainerSource provides containers of a single backend (Docker, Podman, containerd).
+type ContainerSource interface {
+	Ping(context.Context) error
+	ListContainers() ([]string, error)
+	InspectContainer(string) (*Container, error)
+
+	// AddEventListener sends events to out until ctx is done.
+	AddEventListener(context.Context, chan<- *Event) error
+}
+
+// sendEvent sends event to out, it returns false when ctx is done.
+func sendEvent(ctx context.Context, out chan<- *Event, event *Event) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case out <- event:
+		return true
+	}
+}
+
+// appendIPv4 appends parsed IPv4 address to the list, invalid and duplicate
+// addresses are ignored.
+func appendIPv4(list []net.IP, address string) []net.IP {
+	ip := net.ParseIP(address).To4()
+	if ip == nil {
+		return list
+	}
+
+	for _, item := range list {
+		if item.Equal(ip) {
+			return list
+		}
+	}
+
+	return append(list, ip)
+}
@@ -0,0 +1,100 @@
+package dns
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/url"
+	"os/exec"
+	"time"
+)
+
+// sshDialer connects to remote Docker daemon the same way as docker CLI does:
+// it runs `docker system dial-stdio` on the remote host over ssh.
+type sshDialer struct {
+	uri *url.URL
+}
+
+type sshAddr string
+
+// sshConn wraps stdin/stdout of ssh process as net.Conn.
+type sshConn struct {
+	io.Reader
+	io.WriteCloser
+
+	cmd *exec.Cmd
+	dst sshAddr
+}
+
+var _ net.Conn = (*sshConn)(nil)
+
+// lookPath allows to replace ssh client lookup in tests.
+var lookPath = exec.LookPath
+
+// sshAvailable returns true when ssh client could be found in PATH.
+func sshAvailable() bool {
+	_, err := lookPath("ssh")
+
+	return err == nil
+}
+
+func newSSHDialer(uri *url.URL) *sshDialer { return &sshDialer{uri: uri} }
+
+func (a sshAddr) Network() string { return "ssh" }
+
+func (a sshAddr) String() string { return string(a) }
+
+func (d *sshDialer) Dial(_, _ string) (net.Conn, error) {
+	args := []string{"-T", "-o", "BatchMode=yes"}
+	if port := d.uri.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+
+	host := d.uri.Hostname()
+	if d.uri.User != nil {
+		host = d.uri.User.Username() + "@" + host
+	}
+
+	args = append(args, "--", host, "docker", "system", "dial-stdio")
+
+	cmd := exec.CommandContext(context.Background(), "ssh", args...)
+
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &sshConn{Reader: out, WriteCloser: in, cmd: cmd, dst: sshAddr(d.uri.Host)}, nil
+}
+
+func (c *sshConn) Close() error {
+	err := c.WriteCloser.Close()
+	if c.cmd.Process != nil {
+		_ = c.cmd.Process.Kill()
+	}
+
+	_ = c.cmd.Wait()
+
+	return err
+}
+
+func (c *sshConn) LocalAddr() net.Addr { return sshAddr("local") }
+
+func (c *sshConn) RemoteAddr() net.Addr { return c.dst }
+
+// deadlines are not supported by pipes, connections are closed by the client.
+
+func (c *sshConn) SetDeadline(time.Time) error { return nil }
+
+func (c *sshConn) SetReadDeadline(time.Time) error { return nil }
+
+func (c *sshConn) SetWriteDeadline(time.Time) error { return nil }
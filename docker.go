@@ -4,74 +4,121 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"sync/atomic"
 
 	"github.com/docker/docker/libnetwork/netutils"
-	docker "github.com/fsouza/go-dockerclient"
 	"github.com/im-kulikov/go-bones/logger"
 	"github.com/miekg/dns"
 	"go.uber.org/zap"
 )
 
-type DockerClient interface {
-	InspectContainer(string) (*docker.Container, error)
-	ListContainers(docker.ListContainersOptions) ([]docker.APIContainers, error)
-}
-
 type dockerStore struct {
 	cacher Cacher
-	client DockerClient
+	client ContainerSource
 	logger logger.Logger
+	labels []string
+	health bool
+
+	subdomain string
+
+	// rot used to rotate answers of scaled services
+	rot atomic.Uint32
 }
 
 var _ Cacher = (*dockerStore)(nil)
 
-func (d *dockerStore) findContainerByHostname(hostname string) (*docker.Container, error) {
-	containers, err := d.client.ListContainers(docker.ListContainersOptions{})
+// findContainersByHostname returns every container (replica) with passed hostname.
+// When there is no exact match, containers labeled as wildcard owners of the
+// closest parent name are returned.
+func (d *dockerStore) findContainersByHostname(hostname string) ([]*Container, error) {
+	containers, err := d.client.ListContainers()
 	if err != nil {
 		return nil, err
 	}
 
-	for _, container := range containers {
-		var item *docker.Container
-		if item, err = d.client.InspectContainer(container.ID); err != nil {
+	var (
+		out []*Container
+		wld []*Container
+		enc string
+	)
+
+	for _, cid := range containers {
+		var item *Container
+		if item, err = d.client.InspectContainer(cid); err != nil {
 			d.logger.Warnw("could not inspect container",
-				zap.String("container", container.ID),
+				zap.String("container", cid),
 				zap.Error(err))
 
 			continue
 		}
 
-		if item.Config.Hostname+"." == hostname {
-			return item, nil
+		name := containerName(item, d.subdomain)
+		if name != hostname && (!isWildcard(item) || !isSubdomainOf(hostname, name)) {
+			continue
+		}
+
+		if !isPublishable(item, d.health) {
+			d.logger.Debugw("ignoring unhealthy container",
+				zap.String("container", cid),
+				zap.String("health", item.Health))
+
+			continue
+		}
+
+		switch {
+		case name == hostname:
+			out = append(out, item)
+		case len(name) > len(enc):
+			// closer wildcard owner found
+			enc, wld = name, []*Container{item}
+		case name == enc:
+			wld = append(wld, item)
 		}
 	}
 
-	return nil, ErrNotFound
+	if len(out) == 0 {
+		out = wld
+	}
+
+	if len(out) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return out, nil
 }
 
 func (d *dockerStore) fetchAllRecords(query dns.Question) ([]dns.RR, error) {
-	containers, err := d.client.ListContainers(docker.ListContainersOptions{})
+	containers, err := d.client.ListContainers()
 	if err != nil {
 		return nil, err
 	}
 
 	var records []dns.RR
-	for _, container := range containers {
-		var item *docker.Container
-		if item, err = d.client.InspectContainer(container.ID); err != nil {
+	for _, cid := range containers {
+		var item *Container
+		if item, err = d.client.InspectContainer(cid); err != nil {
 			d.logger.Warnw("could not inspect container",
 				zap.Stringer("query", question([]dns.Question{query})),
-				zap.String("container", container.ID),
+				zap.String("container", cid),
 				zap.Error(err))
 
 			continue
 		}
 
-		if strings.Count(item.Config.Hostname, ".") < 1 {
+		if strings.Count(item.Hostname, ".") < 1 {
 			d.logger.Warnw("ignoring container with invalid hostname",
 				zap.Stringer("query", question([]dns.Question{query})),
-				zap.String("container", container.ID),
-				zap.String("hostname", item.Config.Hostname))
+				zap.String("container", cid),
+				zap.String("hostname", item.Hostname))
+
+			continue
+		}
+
+		if !isPublishable(item, d.health) {
+			d.logger.Debugw("ignoring unhealthy container",
+				zap.Stringer("query", question([]dns.Question{query})),
+				zap.String("container", cid),
+				zap.String("health", item.Health))
 
 			continue
 		}
@@ -80,7 +127,7 @@ func (d *dockerStore) fetchAllRecords(query dns.Question) ([]dns.RR, error) {
 		if ip, err = fetchIPAddress(item); err != nil {
 			d.logger.Warnw("could not fetch ip address",
 				zap.Stringer("query", question([]dns.Question{query})),
-				zap.String("container", container.ID),
+				zap.String("container", cid),
 				zap.Error(err))
 
 			continue
@@ -88,7 +135,7 @@ func (d *dockerStore) fetchAllRecords(query dns.Question) ([]dns.RR, error) {
 
 		rec := &dns.A{
 			Hdr: dns.RR_Header{
-				Name:   item.Config.Hostname + ".",
+				Name:   containerName(item, d.subdomain),
 				Rrtype: dns.TypeA,
 				Class:  dns.ClassINET,
 				Ttl:    3600,
@@ -102,56 +149,48 @@ func (d *dockerStore) fetchAllRecords(query dns.Question) ([]dns.RR, error) {
 			Name:   rec.Hdr.Name,
 			Qtype:  query.Qtype,
 			Qclass: query.Qclass,
-		}, container.ID, []dns.RR{rec})
+		}, cid, []dns.RR{rec})
 	}
 
 	return records, nil
 }
 
-func fetchIPAddress(container *docker.Container) (net.IP, error) {
-	if container.NetworkSettings.IPAddress != "" {
-		return net.ParseIP(container.NetworkSettings.IPAddress), nil
-	}
-
-	if container.NetworkSettings.Networks != nil {
-		for _, network := range container.NetworkSettings.Networks {
-			if network.IPAddress != "" {
-				return net.ParseIP(network.IPAddress), nil
-			}
-		}
+func fetchIPAddress(container *Container) (net.IP, error) {
+	if len(container.Addresses) > 0 {
+		return container.Addresses[0], nil
 	}
 
 	return nil, fmt.Errorf("container %s: %w", container.Name, ErrIPNotFound)
 }
 
-func (d *dockerStore) fetchContainerByIP(ip string) (*docker.Container, error) {
-	containers, err := d.client.ListContainers(docker.ListContainersOptions{})
+func (d *dockerStore) fetchContainerByIP(ip string) (*Container, error) {
+	containers, err := d.client.ListContainers()
 	if err != nil {
 		return nil, err
 	}
 
-	for _, container := range containers {
-		var item *docker.Container
-		if item, err = d.client.InspectContainer(container.ID); err != nil {
+	for _, cid := range containers {
+		var item *Container
+		if item, err = d.client.InspectContainer(cid); err != nil {
 			d.logger.Warnw("could not inspect container",
-				zap.String("container", container.ID),
+				zap.String("container", cid),
 				zap.Error(err))
 
 			continue
 		}
 
-		if item.NetworkSettings.IPAddress == ip {
-			return item, nil
+		if !isPublishable(item, d.health) {
+			continue
 		}
 
-		for _, network := range item.NetworkSettings.Networks {
-			if network.IPAddress == ip {
+		for _, address := range item.Addresses {
+			if address.String() == ip {
 				return item, nil
 			}
 
 			d.logger.Warnw("ignore container with invalid ip address",
-				zap.String("container.id", container.ID),
-				zap.String("container.ip", network.IPAddress),
+				zap.String("container.id", cid),
+				zap.Stringer("container.ip", address),
 				zap.String("request.ip", ip))
 		}
 	}
@@ -175,7 +214,7 @@ func (d *dockerStore) fetchByIP(ip string, query dns.Question) ([]dns.RR, error)
 
 	out := []dns.RR{
 		&dns.PTR{
-			Ptr: container.Config.Hostname + ".",
+			Ptr: containerName(container, d.subdomain),
 			Hdr: dns.RR_Header{
 				Name:   query.Name,
 				Rrtype: dns.TypePTR,
@@ -191,31 +230,63 @@ func (d *dockerStore) fetchByIP(ip string, query dns.Question) ([]dns.RR, error)
 }
 
 func (d *dockerStore) fetchByHostname(query dns.Question) ([]dns.RR, error) {
-	container, err := d.findContainerByHostname(query.Name)
+	containers, err := d.findContainersByHostname(query.Name)
 	if err != nil {
 		return nil, err
 	}
 
-	ip, err := fetchIPAddress(container)
+	var out []dns.RR
+	for _, container := range containers {
+		var ip net.IP
+		if ip, err = fetchIPAddress(container); err != nil {
+			d.logger.Warnw("could not fetch ip address",
+				Query(query).Fields(
+					zap.String("container", container.ID),
+					zap.Error(err))...)
+
+			continue
+		}
+
+		rec := []dns.RR{
+			&dns.A{
+				Hdr: dns.RR_Header{
+					Name:   query.Name,
+					Rrtype: dns.TypeA,
+					Class:  dns.ClassINET,
+					Ttl:    3600,
+				},
+				A: ip,
+			},
+		}
+
+		d.cacheResult(query, container.ID, rec)
+
+		out = append(out, rec...)
+	}
+
+	if len(out) == 0 {
+		return nil, fmt.Errorf("hostname %s: %w", query.Name, ErrIPNotFound)
+	}
+
+	return rotate(out, d.rot.Add(1)), nil
+}
+
+func (d *dockerStore) fetchTXT(query dns.Question) ([]dns.RR, error) {
+	containers, err := d.findContainersByHostname(query.Name)
 	if err != nil {
 		return nil, err
 	}
 
-	out := []dns.RR{
-		&dns.A{
-			Hdr: dns.RR_Header{
-				Name:   query.Name,
-				Rrtype: dns.TypeA,
-				Class:  dns.ClassINET,
-				Ttl:    3600,
-			},
-			A: ip,
-		},
-	}
+	out := make([]dns.RR, 0, len(containers))
+	for _, container := range containers {
+		rec := []dns.RR{containerTXT(query.Name, container, d.labels)}
 
-	d.cacheResult(query, container.ID, out)
+		d.cacheResult(query, container.ID, rec)
 
-	return out, nil
+		out = append(out, rec...)
+	}
+
+	return rotate(out, d.rot.Add(1)), nil
 }
 
 func (d *dockerStore) Get(query dns.Question) ([]dns.RR, error) {
@@ -226,6 +297,10 @@ func (d *dockerStore) Get(query dns.Question) ([]dns.RR, error) {
 		}
 
 		return d.fetchByHostname(query)
+	case dns.TypeTXT:
+		return d.fetchTXT(query)
+	case dns.TypeCNAME:
+		return d.fetchAlias(query)
 	case dns.TypePTR:
 		if !strings.Contains(query.Name, ".in-addr.arpa.") {
 			return nil, ErrNotFound
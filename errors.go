@@ -7,6 +7,10 @@ const (
 	ErrNotFound   Error = "not found"
 	ErrIPNotFound Error = "ip not found"
 	ErrAlreadySet Error = "already set"
+	ErrCNAMELoop  Error = "cname loop"
+
+	ErrUpdateFailed  Error = "dynamic update failed"
+	ErrUpdateRefused Error = "dynamic update refused"
 )
 
 func (e Error) Error() string { return string(e) }
@@ -18,16 +18,26 @@ func (q question) String() string {
 	return strings.Join(s, ", ")
 }
 
+// defaultUpstream resolves queries, that are not known locally.
+const defaultUpstream = "8.8.8.8:53"
+
+// exchange sends request to the upstream resolver.
+func (s *server) exchange(req *dns.Msg) (*dns.Msg, error) {
+	s.Once.Do(func() { s.client = &dns.Client{Net: "udp"} })
+
+	res, _, err := s.client.Exchange(req, s.upstream)
+
+	return res, err
+}
+
 func (s *server) externalExchange(req, out *dns.Msg) error {
 	if len(out.Answer) > 0 {
 		return ErrAlreadySet
 	}
 
-	s.Once.Do(func() { s.client = &dns.Client{Net: "udp"} })
-
 	s.logger.Debugw("exchange with Google DNS")
 
-	res, _, err := s.client.Exchange(req, "8.8.8.8:53")
+	res, err := s.exchange(req)
 	if err != nil {
 		return err
 	}
@@ -52,7 +62,7 @@ func (s *server) internalExchange(req, out *dns.Msg) error {
 		s.logger.Debugw("resolving dns",
 			Query(q).Fields()...)
 
-		rec, err := s.stores.Get(q)
+		rec, err := s.chase(q)
 		if err != nil {
 			s.logger.Warnw("fetch record failed",
 				Query(q).Fields(zap.Error(err))...)
@@ -71,6 +81,12 @@ func (s *server) internalExchange(req, out *dns.Msg) error {
 }
 
 func (s *server) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	if s.isTransfer(req) {
+		s.serveTransfer(w, req)
+
+		return
+	}
+
 	reply := &dns.Msg{}
 	reply.SetReply(req)
 
@@ -0,0 +1,32 @@
+package dns
+
+import (
+	"strings"
+)
+
+const (
+	// labelIgnoreHealth allows container to opt out of health-aware publishing.
+	labelIgnoreHealth = "docker-dns.ignore-health"
+
+	healthStatusEvent = "health_status"
+	healthStatusReady = "healthy"
+)
+
+// isPublishable returns true when records of the container could be served.
+// Containers without healthcheck are always published.
+func isPublishable(container *Container, healthyOnly bool) bool {
+	if !healthyOnly || container.Health == "" {
+		return true
+	}
+
+	if container.Labels[labelIgnoreHealth] == "true" {
+		return true
+	}
+
+	return container.Health == healthStatusReady
+}
+
+// isHealthEvent returns true for events like `health_status: healthy`.
+func isHealthEvent(action string) bool {
+	return strings.HasPrefix(action, healthStatusEvent)
+}
@@ -0,0 +1,97 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/im-kulikov/go-bones/logger"
+	"go.uber.org/zap"
+)
+
+// Host represents single container host (Docker, Podman or containerd)
+// with its own event cache.
+// It implements web.HealthChecker, so status of each host is exposed
+// through the ops server.
+type Host struct {
+	cfg DockerHostConfig
+	src ContainerSource
+	wrk CacheWorker
+	swm CacheWorker
+	str *dockerStore
+}
+
+const hostCheckInterval = time.Second * 10
+
+// NewHosts prepares clients and event caches for every configured Docker host.
+func NewHosts(cfg Config, log logger.Logger) ([]*Host, error) {
+	list, err := ParseDockerHosts(cfg.Hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*Host, 0, len(list))
+	for _, item := range list {
+		host := &Host{cfg: item}
+		hlog := log.With(zap.String("docker.host", item.Name))
+
+		if host.src, err = item.prepareSource(hlog); err != nil {
+			return nil, fmt.Errorf("docker host %s: could not prepare client: %w", item.Name, err)
+		}
+
+		if host.wrk, err = NewCache(cfg, item, host.src, hlog); err != nil {
+			return nil, fmt.Errorf("docker host %s: could not prepare cache: %w", item.Name, err)
+		}
+
+		// swarm is supported by Docker backend only
+		if src, ok := host.src.(*dockerSource); ok && cfg.Swarm {
+			if host.swm, err = NewSwarmCache(cfg, item, src.cli, hlog); err != nil {
+				return nil, fmt.Errorf("docker host %s: could not prepare swarm cache: %w", item.Name, err)
+			}
+		}
+
+		host.str = &dockerStore{
+			cacher:    host.wrk,
+			client:    host.src,
+			logger:    hlog,
+			labels:    cfg.Labels,
+			health:    cfg.HealthyOnly,
+			subdomain: item.Subdomain,
+		}
+
+		hlog.Infow("docker host prepared",
+			zap.String("backend", item.Backend),
+			zap.String("endpoint", item.Endpoint),
+			zap.String("subdomain", item.Subdomain))
+
+		out = append(out, host)
+	}
+
+	return out, nil
+}
+
+// Workers returns event caches of the host, that should be started.
+func (h *Host) Workers() []CacheWorker {
+	if h.swm == nil {
+		return []CacheWorker{h.wrk}
+	}
+
+	return []CacheWorker{h.wrk, h.swm}
+}
+
+// Name returns name of the health checker.
+func (h *Host) Name() string { return "docker-host-" + h.cfg.Name }
+
+// Interval returns interval of the health checks.
+func (h *Host) Interval() time.Duration { return hostCheckInterval }
+
+// Healthy checks that container backend is reachable.
+func (h *Host) Healthy(ctx context.Context) error { return h.src.Ping(ctx) }
+
+func (h *Host) store() Cacher {
+	if h.swm == nil {
+		return &chainStore{stores: []Cacher{h.wrk, h.str}}
+	}
+
+	return &chainStore{stores: []Cacher{h.wrk, h.swm, h.str}}
+}
@@ -1,6 +1,7 @@
 package admin
 
 import (
+	"github.com/im-kulikov/docker-dns/internal/broadcast"
 	"github.com/im-kulikov/go-bones/logger"
 	"github.com/im-kulikov/go-bones/service"
 )
@@ -13,5 +14,6 @@ type Interface interface {
 
 type server struct {
 	rec Storage
+	brd broadcast.Refresher
 	log logger.Logger
 }
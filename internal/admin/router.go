@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/im-kulikov/docker-dns/internal/broadcast"
 	"github.com/im-kulikov/docker-dns/internal/cacher"
 	"github.com/miekg/dns"
 )
@@ -16,6 +17,8 @@ type ResponseItem struct {
 	Domain string        `json:"domain"`
 	Record []string      `json:"record"`
 	Expire time.Duration `json:"expire"`
+
+	Attributes *broadcast.Attributes `json:"attributes,omitempty"`
 }
 
 type ResponseList struct {
@@ -48,6 +51,34 @@ var root embed.FS
 
 var content, _ = fs.Sub(root, "frontend")
 
+// newCacheItem creates cache item with BGP attributes from request
+func newCacheItem(item ResponseItem) (*cacher.CacheItem, error) {
+	out := cacher.NewItem(item.Domain)
+	if item.Attributes == nil {
+		return out, nil
+	}
+
+	if err := item.Attributes.Validate(); err != nil {
+		return nil, err
+	}
+
+	out.Attrs = *item.Attributes
+
+	return out, nil
+}
+
+func responseItem(item *cacher.CacheItem) ResponseItem {
+	attrs := item.Attrs
+
+	return ResponseItem{
+		Domain: item.Domain,
+		Record: item.Record,
+		Expire: time.Second * time.Duration(item.Expire),
+
+		Attributes: &attrs,
+	}
+}
+
 func validateDomain(domain string) error {
 	if domain == "" {
 		return errors.New("domain is required")
@@ -61,12 +92,7 @@ func validateDomain(domain string) error {
 func (s *server) listCacheItems(w http.ResponseWriter, _ *http.Request) error {
 	var result ResponseList
 	for _, item := range s.rec.List() {
-		result.List = append(result.List, ResponseItem{
-			Domain: item.Domain,
-			Record: item.Record,
-			Expire: time.Second * time.Duration(item.Expire),
-		})
-
+		result.List = append(result.List, responseItem(item))
 	}
 
 	return json.NewEncoder(w).Encode(Response{ResponseList: &result})
@@ -90,7 +116,20 @@ func (s *server) createCacheItem(w http.ResponseWriter, r *http.Request) error {
 		})
 	}
 
-	if !s.rec.Set(item.Domain, cacher.NewItem(item.Domain)) {
+	rec, err := newCacheItem(item)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return json.NewEncoder(w).Encode(Response{
+			ErrorResponse: &ErrorResponse{
+				Code:        "400",
+				Message:     "Invalid attributes",
+				Description: err.Error(),
+			},
+		})
+	}
+
+	if !s.rec.Set(item.Domain, rec) {
 		w.WriteHeader(http.StatusBadRequest)
 
 		return json.NewEncoder(w).Encode(Response{
@@ -121,13 +160,9 @@ func (s *server) getCacheItem(w http.ResponseWriter, r *http.Request) error {
 		})
 	}
 
-	out := &ResponseItem{
-		Domain: item.Domain,
-		Record: item.Record,
-		Expire: time.Second * time.Duration(item.Expire),
-	}
+	out := responseItem(item)
 
-	if err := json.NewEncoder(w).Encode(Response{ResponseItem: out}); err != nil {
+	if err := json.NewEncoder(w).Encode(Response{ResponseItem: &out}); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 
@@ -164,7 +199,20 @@ func (s *server) updateCacheItem(w http.ResponseWriter, r *http.Request) error {
 		})
 	}
 
-	if !s.rec.Set(item.Domain, cacher.NewItem(item.Domain)) {
+	rec, err := newCacheItem(item)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+
+		return json.NewEncoder(w).Encode(Response{
+			ErrorResponse: &ErrorResponse{
+				Code:        "400",
+				Message:     "Invalid attributes",
+				Description: err.Error(),
+			},
+		})
+	}
+
+	if !s.rec.Set(item.Domain, rec) {
 		w.WriteHeader(http.StatusBadRequest)
 
 		return json.NewEncoder(w).Encode(Response{
@@ -175,7 +223,10 @@ func (s *server) updateCacheItem(w http.ResponseWriter, r *http.Request) error {
 		})
 	}
 
-	s.rec.Delete(oldDomain)
+	// attributes could be changed without renaming the domain
+	if oldDomain != item.Domain {
+		s.rec.Delete(oldDomain)
+	}
 
 	w.WriteHeader(http.StatusAccepted)
 
@@ -202,6 +253,26 @@ func (s *server) deleteCacheItem(w http.ResponseWriter, r *http.Request) error {
 	return nil
 }
 
+// resyncPeers replays full table to the peer from path or to every peer
+func (s *server) resyncPeers(w http.ResponseWriter, r *http.Request) error {
+	peer := r.PathValue("peer")
+
+	if !s.brd.Refresh(peer) {
+		w.WriteHeader(http.StatusNotFound)
+
+		return json.NewEncoder(w).Encode(Response{
+			ErrorResponse: &ErrorResponse{
+				Code:    "404",
+				Message: "Peer not found",
+			},
+		})
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+
+	return nil
+}
+
 // wrapErrorHandler оборачивает ErrorHandler, чтобы обрабатывать ошибки
 func wrapErrorHandler(handler ErrorHandler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -233,6 +304,8 @@ func (s *server) router() http.Handler {
 	mux.HandleFunc("GET /api/{domain}/", wrapErrorHandler(s.getCacheItem))
 	mux.HandleFunc("PUT /api/{domain}/", wrapErrorHandler(s.updateCacheItem))
 	mux.HandleFunc("DELETE /api/{domain}/", wrapErrorHandler(s.deleteCacheItem))
+	mux.HandleFunc("POST /api/peers/resync", wrapErrorHandler(s.resyncPeers))
+	mux.HandleFunc("POST /api/peers/{peer}/resync", wrapErrorHandler(s.resyncPeers))
 
 	return mux
 }
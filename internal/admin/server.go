@@ -1,13 +1,14 @@
 package admin
 
 import (
+	"github.com/im-kulikov/docker-dns/internal/broadcast"
 	"github.com/im-kulikov/go-bones/logger"
 	"github.com/im-kulikov/go-bones/service"
 	"github.com/im-kulikov/go-bones/web"
 )
 
-func New(cfg web.HTTPConfig, log logger.Logger, rec Storage) service.Service {
-	srv := &server{rec: rec, log: log}
+func New(cfg web.HTTPConfig, log logger.Logger, rec Storage, brd broadcast.Refresher) service.Service {
+	srv := &server{rec: rec, brd: brd, log: log}
 
 	return web.NewHTTPServer(
 		web.WithHTTPConfig(cfg),
@@ -0,0 +1,146 @@
+package bgp
+
+import (
+	"encoding/binary"
+	"github.com/im-kulikov/docker-dns/internal/broadcast"
+	"github.com/jwhited/corebgp"
+	"net/netip"
+	"time"
+)
+
+// maxRestartTime is the maximum restart time of graceful restart capability.
+const maxRestartTime = time.Second * 4095
+
+// safiFlowSpec is SAFI of FlowSpec rules (RFC 8955).
+const safiFlowSpec uint8 = 133
+
+// capabilities returns capabilities advertised to every peer, safi is either
+// unicast or FlowSpec one. Four-octet AS capability is advertised by corebgp itself.
+// ROUTE-REFRESH is answered by refreshConn, before messages reach corebgp.
+// Extended messages are not advertised, corebgp rejects messages over 4096 bytes.
+func capabilities(restart time.Duration, flags restartFlags, safi uint8) []corebgp.Capability {
+	out := []corebgp.Capability{
+		corebgp.NewMPExtensionsCapability(corebgp.AFI_IPV4, safi),
+		corebgp.NewMPExtensionsCapability(corebgp.AFI_IPV6, safi),
+		{Code: corebgp.CAP_ROUTE_REFRESH},
+	}
+
+	if restart > 0 {
+		out = append(out, gracefulRestartCapability(restart, flags, safi))
+	}
+
+	return out
+}
+
+// restartFlags are flags of graceful restart capability.
+type restartFlags struct {
+	// restarting sets R flag, when sessions are re-established after restart
+	restarting bool
+
+	// preserved sets F flag, when announced routes are persisted and
+	// re-announced after restart, so peers keep them as stale ones
+	preserved bool
+}
+
+// gracefulRestartCapability encodes capability of RFC 4724.
+func gracefulRestartCapability(restart time.Duration, flags restartFlags, safi uint8) corebgp.Capability {
+	if restart > maxRestartTime {
+		restart = maxRestartTime
+	}
+
+	header := uint16(restart/time.Second) & 0x0fff
+	if flags.restarting {
+		header |= 0x8000
+	}
+
+	var forwarding uint8
+	if flags.preserved {
+		forwarding = 0x80
+	}
+
+	value := make([]byte, 2, 10)
+	binary.BigEndian.PutUint16(value, header)
+
+	for _, afi := range []uint16{corebgp.AFI_IPV4, corebgp.AFI_IPV6} {
+		value = binary.BigEndian.AppendUint16(value, afi)
+		value = append(value, safi, forwarding)
+	}
+
+	return corebgp.Capability{Code: corebgp.CAP_GRACEFUL_RESTART, Value: value}
+}
+
+// negotiate returns capabilities supported by both sides, or NOTIFICATION
+// when peer capabilities are incompatible.
+func negotiate(peer corebgp.PeerConfig, remote []corebgp.Capability, safi uint8) (broadcast.Capabilities, *corebgp.Notification) {
+	var (
+		out broadcast.Capabilities
+		mpe bool
+	)
+
+	for _, capability := range remote {
+		switch capability.Code {
+		case corebgp.CAP_MP_EXTENSIONS:
+			if len(capability.Value) != 4 {
+				continue
+			}
+
+			mpe = true
+			switch afi := binary.BigEndian.Uint16(capability.Value); {
+			case afi == corebgp.AFI_IPV4 && capability.Value[3] == corebgp.SAFI_UNICAST:
+				out.IPv4Unicast = true
+			case afi == corebgp.AFI_IPV6 && capability.Value[3] == corebgp.SAFI_UNICAST:
+				out.IPv6Unicast = true
+			case afi == corebgp.AFI_IPV4 && capability.Value[3] == safiFlowSpec:
+				out.IPv4FlowSpec = true
+			case afi == corebgp.AFI_IPV6 && capability.Value[3] == safiFlowSpec:
+				out.IPv6FlowSpec = true
+			}
+		case corebgp.CAP_FOUR_OCTET_AS:
+			if len(capability.Value) == 4 {
+				out.FourOctetAS = binary.BigEndian.Uint32(capability.Value) == peer.RemoteAS
+			}
+		case corebgp.CAP_GRACEFUL_RESTART:
+			out.GracefulRestart = len(capability.Value) >= 2
+		}
+	}
+
+	// peer without multiprotocol capability supports IPv4 unicast only (RFC 4760)
+	if !mpe {
+		out.IPv4Unicast = true
+	}
+
+	switch {
+	case safi == safiFlowSpec && !out.IPv4FlowSpec && !out.IPv6FlowSpec,
+		safi != safiFlowSpec && !out.IPv4Unicast && !out.IPv6Unicast:
+		var data []byte
+		for _, capability := range capabilities(0, restartFlags{}, safi)[:2] {
+			data = append(data, capability.Code, uint8(len(capability.Value)))
+			data = append(data, capability.Value...)
+		}
+
+		return out, &corebgp.Notification{
+			Code:    corebgp.NOTIF_CODE_OPEN_MESSAGE_ERR,
+			Subcode: corebgp.NOTIF_SUBCODE_UNSUPPORTED_CAPABILITY,
+			Data:    data,
+		}
+	case !out.FourOctetAS && (peer.RemoteAS > 0xffff || peer.LocalAS > 0xffff):
+		// 4-byte AS numbers could not be used without capability (RFC 6793)
+		data := binary.BigEndian.AppendUint32([]byte{corebgp.CAP_FOUR_OCTET_AS, 4}, peer.LocalAS)
+
+		return out, &corebgp.Notification{
+			Code:    corebgp.NOTIF_CODE_OPEN_MESSAGE_ERR,
+			Subcode: corebgp.NOTIF_SUBCODE_UNSUPPORTED_CAPABILITY,
+			Data:    data,
+		}
+	default:
+		return out, nil
+	}
+}
+
+// negotiated keeps capabilities of peers between OPEN and established session.
+func (p *plugin) negotiated(addr netip.Addr) broadcast.Capabilities {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.cps[addr]
+}
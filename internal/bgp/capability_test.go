@@ -0,0 +1,168 @@
+package bgp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/jwhited/corebgp"
+
+	"github.com/im-kulikov/docker-dns/internal/broadcast"
+)
+
+func TestCapabilities(t *testing.T) {
+	var refresh bool
+	for _, capability := range capabilities(0, restartFlags{}, corebgp.SAFI_UNICAST) {
+		switch capability.Code {
+		case corebgp.CAP_MP_EXTENSIONS:
+		case corebgp.CAP_ROUTE_REFRESH:
+			refresh = len(capability.Value) == 0
+		default:
+			t.Fatalf("unexpected capability %d", capability.Code)
+		}
+	}
+
+	if !refresh {
+		t.Fatal("route refresh capability is not advertised")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	fourOctet := func(as uint32) corebgp.Capability {
+		return corebgp.Capability{Code: corebgp.CAP_FOUR_OCTET_AS, Value: binary.BigEndian.AppendUint32(nil, as)}
+	}
+
+	cases := []struct {
+		name   string
+		peer   corebgp.PeerConfig
+		remote []corebgp.Capability
+		safi   uint8
+		want   broadcast.Capabilities
+		fail   bool
+	}{
+		{
+			name: "without multiprotocol",
+			peer: corebgp.PeerConfig{LocalAS: 65000, RemoteAS: 65001},
+			safi: corebgp.SAFI_UNICAST,
+			want: broadcast.Capabilities{IPv4Unicast: true},
+		},
+		{
+			name: "dual stack",
+			peer: corebgp.PeerConfig{LocalAS: 65000, RemoteAS: 65001},
+			remote: []corebgp.Capability{
+				corebgp.NewMPExtensionsCapability(corebgp.AFI_IPV4, corebgp.SAFI_UNICAST),
+				corebgp.NewMPExtensionsCapability(corebgp.AFI_IPV6, corebgp.SAFI_UNICAST),
+				fourOctet(65001),
+				{Code: corebgp.CAP_GRACEFUL_RESTART, Value: []byte{0, 120}},
+			},
+			safi: corebgp.SAFI_UNICAST,
+			want: broadcast.Capabilities{IPv4Unicast: true, IPv6Unicast: true, FourOctetAS: true, GracefulRestart: true},
+		},
+		{
+			name:   "ipv6 only",
+			peer:   corebgp.PeerConfig{LocalAS: 65000, RemoteAS: 65001},
+			remote: []corebgp.Capability{corebgp.NewMPExtensionsCapability(corebgp.AFI_IPV6, corebgp.SAFI_UNICAST)},
+			safi:   corebgp.SAFI_UNICAST,
+			want:   broadcast.Capabilities{IPv6Unicast: true},
+		},
+		{
+			name:   "flowspec",
+			peer:   corebgp.PeerConfig{LocalAS: 65000, RemoteAS: 65001},
+			remote: []corebgp.Capability{corebgp.NewMPExtensionsCapability(corebgp.AFI_IPV4, safiFlowSpec)},
+			safi:   safiFlowSpec,
+			want:   broadcast.Capabilities{IPv4FlowSpec: true},
+		},
+		{
+			name:   "flowspec without support",
+			peer:   corebgp.PeerConfig{LocalAS: 65000, RemoteAS: 65001},
+			remote: []corebgp.Capability{corebgp.NewMPExtensionsCapability(corebgp.AFI_IPV4, corebgp.SAFI_UNICAST)},
+			safi:   safiFlowSpec,
+			fail:   true,
+		},
+		{
+			name:   "unicast without support",
+			peer:   corebgp.PeerConfig{LocalAS: 65000, RemoteAS: 65001},
+			remote: []corebgp.Capability{corebgp.NewMPExtensionsCapability(corebgp.AFI_IPV4, safiFlowSpec)},
+			safi:   corebgp.SAFI_UNICAST,
+			fail:   true,
+		},
+		{
+			name: "four octet as without capability",
+			peer: corebgp.PeerConfig{LocalAS: 65000, RemoteAS: 4200000000},
+			safi: corebgp.SAFI_UNICAST,
+			fail: true,
+		},
+		{
+			name:   "four octet as mismatch",
+			peer:   corebgp.PeerConfig{LocalAS: 4200000000, RemoteAS: 65001},
+			remote: []corebgp.Capability{fourOctet(65002)},
+			safi:   corebgp.SAFI_UNICAST,
+			fail:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, notification := negotiate(tc.peer, tc.remote, tc.safi)
+			if tc.fail {
+				if notification == nil || notification.Code != corebgp.NOTIF_CODE_OPEN_MESSAGE_ERR {
+					t.Fatalf("expected OPEN message error, got %v", notification)
+				}
+
+				return
+			}
+
+			if notification != nil {
+				t.Fatalf("unexpected notification %v", notification)
+			} else if got != tc.want {
+				t.Fatalf("expected %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestGracefulRestartCapability(t *testing.T) {
+	cases := []struct {
+		name    string
+		restart time.Duration
+		flags   restartFlags
+		safi    uint8
+		want    []byte
+	}{
+		{
+			name:    "unicast",
+			restart: time.Second * 120,
+			safi:    corebgp.SAFI_UNICAST,
+			want:    []byte{0x00, 0x78, 0, 1, 1, 0x00, 0, 2, 1, 0x00},
+		},
+		{
+			name:    "restarting with preserved routes",
+			restart: time.Second * 120,
+			flags:   restartFlags{restarting: true, preserved: true},
+			safi:    corebgp.SAFI_UNICAST,
+			want:    []byte{0x80, 0x78, 0, 1, 1, 0x80, 0, 2, 1, 0x80},
+		},
+		{
+			name:    "limited restart time",
+			restart: time.Hour * 2,
+			safi:    safiFlowSpec,
+			want:    []byte{0x0f, 0xff, 0, 1, 133, 0x00, 0, 2, 133, 0x00},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := gracefulRestartCapability(tc.restart, tc.flags, tc.safi)
+			if got.Code != corebgp.CAP_GRACEFUL_RESTART {
+				t.Fatalf("expected graceful restart capability, got %d", got.Code)
+			} else if !bytes.Equal(got.Value, tc.want) {
+				t.Fatalf("expected %x, got %x", tc.want, got.Value)
+			}
+		})
+	}
+
+	if list := capabilities(time.Minute, restartFlags{}, corebgp.SAFI_UNICAST); list[len(list)-1].Code != corebgp.CAP_GRACEFUL_RESTART {
+		t.Fatalf("expected graceful restart capability to be advertised, got %v", list)
+	}
+}
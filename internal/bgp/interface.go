@@ -18,7 +18,8 @@ func (s *server) Enabled() bool { return s.cfg.Enabled }
 
 // Start implements service.Service interface
 func (s *server) Start(ctx context.Context) error {
-	var lc net.ListenConfig
+	// passive peers with MD5 password are authenticated by listener
+	lc := net.ListenConfig{Control: md5Control(s.prs...)}
 	lis, err := lc.Listen(ctx, s.cfg.Network, s.cfg.Address)
 	if err != nil {
 		return err
@@ -28,10 +29,18 @@ func (s *server) Start(ctx context.Context) error {
 
 	defer func() { s.log.Infow("bgp server stopped") }()
 
-	return s.srv.Serve([]net.Listener{lis})
+	for _, peer := range s.prs {
+		if !peer.Passive {
+			go s.dls.dial(peer)
+		}
+	}
+
+	return s.srv.Serve([]net.Listener{&refreshListener{Listener: lis, wrap: s.wrap}, s.dls})
 }
 
 // Stop implements service.Service interface
 func (s *server) Stop(context.Context) {
+	_ = s.dls.Close()
+
 	s.srv.Close()
 }
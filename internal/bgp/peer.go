@@ -0,0 +1,131 @@
+package bgp
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHoldTime = time.Second * 90
+
+	modePassive = "passive"
+	modeActive  = "active"
+)
+
+// PeerConfig describes single BGP peer.
+//
+// It's parsed from string like:
+//
+//	address=10.0.0.1;as=65001;local_as=65000;hold=30s;mode=active;md5=secret;next_hop=10.0.0.2
+//
+// Peer with remote AS different from local AS is treated as eBGP peer.
+type PeerConfig struct {
+	Address  netip.Addr
+	RemoteAS uint32
+	LocalAS  uint32
+	HoldTime time.Duration
+	Passive  bool
+	Port     int
+	Password string
+	NextHop  string
+}
+
+// External returns true for eBGP peers.
+func (p PeerConfig) External() bool { return p.LocalAS != p.RemoteAS }
+
+func parseAS(val string) (uint32, error) {
+	out, err := strconv.ParseUint(val, 10, 32)
+	if err != nil || out == 0 {
+		return 0, fmt.Errorf("invalid AS number %q", val)
+	}
+
+	return uint32(out), nil
+}
+
+// ParsePeers returns peers from Clients (iBGP, passive) and Peers options.
+func ParsePeers(cfg Config) ([]PeerConfig, error) {
+	out := make([]PeerConfig, 0, len(cfg.Clients)+len(cfg.Peers))
+	for _, client := range cfg.Clients {
+		if client = strings.TrimSpace(client); client == "" {
+			continue
+		}
+
+		addr, err := netip.ParseAddr(client)
+		if err != nil {
+			return nil, fmt.Errorf("bgp client %q: %w", client, err)
+		}
+
+		out = append(out, PeerConfig{
+			Address:  addr,
+			RemoteAS: cfg.LocalAS,
+			LocalAS:  cfg.LocalAS,
+			HoldTime: defaultHoldTime,
+			Passive:  true,
+		})
+	}
+
+	for _, item := range cfg.Peers {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+
+		peer := PeerConfig{LocalAS: cfg.LocalAS, HoldTime: defaultHoldTime, Passive: true}
+		for _, pair := range strings.Split(item, ";") {
+			key, val, ok := strings.Cut(pair, "=")
+			if !ok {
+				return nil, fmt.Errorf("bgp peer %q: invalid option %q", item, pair)
+			}
+
+			var err error
+			switch val = strings.TrimSpace(val); strings.TrimSpace(key) {
+			case "address":
+				peer.Address, err = netip.ParseAddr(val)
+			case "as":
+				peer.RemoteAS, err = parseAS(val)
+			case "local_as":
+				peer.LocalAS, err = parseAS(val)
+			case "hold":
+				peer.HoldTime, err = time.ParseDuration(val)
+			case "mode":
+				switch val {
+				case modePassive:
+					peer.Passive = true
+				case modeActive:
+					peer.Passive = false
+				default:
+					err = fmt.Errorf("unknown mode %q", val)
+				}
+			case "port":
+				peer.Port, err = strconv.Atoi(val)
+			case "md5":
+				peer.Password = val
+			case "next_hop":
+				if _, err = netip.ParseAddr(val); err == nil {
+					peer.NextHop = val
+				}
+			default:
+				err = fmt.Errorf("unknown option %q", key)
+			}
+
+			if err != nil {
+				return nil, fmt.Errorf("bgp peer %q: %w", item, err)
+			}
+		}
+
+		switch {
+		case !peer.Address.IsValid():
+			return nil, fmt.Errorf("bgp peer %q: empty address", item)
+		case peer.RemoteAS == 0:
+			return nil, fmt.Errorf("bgp peer %q: empty remote AS", item)
+		case peer.HoldTime != 0 && peer.HoldTime < time.Second*3:
+			return nil, fmt.Errorf("bgp peer %q: hold time should be 0 or at least 3s", item)
+		}
+
+		out = append(out, peer)
+	}
+
+	return out, nil
+}
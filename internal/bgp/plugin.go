@@ -2,6 +2,7 @@ package bgp
 
 import (
 	"net/netip"
+	"sync"
 	"time"
 
 	"github.com/im-kulikov/docker-dns/internal/broadcast"
@@ -14,43 +15,108 @@ type plugin struct {
 	logger.Logger
 
 	rec broadcast.PeerManager
+	prs map[netip.Addr]PeerConfig
+	grt time.Duration
+
+	// kpt is true, when announced routes are persisted by broadcaster
+	kpt bool
+	run time.Time
+
+	// saf is SAFI of announced routes, unicast or FlowSpec
+	saf uint8
+
+	// cps are negotiated capabilities of peers
+	mu  sync.RWMutex
+	cps map[netip.Addr]broadcast.Capabilities
 }
 
-func newPlugin(log logger.Logger, rec broadcast.PeerManager) corebgp.Plugin {
-	return &plugin{Logger: log, rec: rec}
+func newPlugin(log logger.Logger, rec broadcast.PeerManager, peers []PeerConfig, cfg Config) corebgp.Plugin {
+	prs := make(map[netip.Addr]PeerConfig, len(peers))
+	for _, peer := range peers {
+		prs[peer.Address] = peer
+	}
+
+	out := &plugin{
+		Logger: log,
+
+		rec: rec,
+		prs: prs,
+		grt: cfg.Restart,
+		kpt: cfg.Attributes.State != "",
+		run: time.Now(),
+		saf: corebgp.SAFI_UNICAST,
+		cps: make(map[netip.Addr]broadcast.Capabilities),
+	}
+
+	if cfg.Attributes.FlowSpec() {
+		out.saf = safiFlowSpec
+	}
+
+	return out
 }
 
 func (p *plugin) GetCapabilities(peer corebgp.PeerConfig) []corebgp.Capability {
 	p.Infow("peer get capabilities", zap.Any("peer", peer))
-	caps := make([]corebgp.Capability, 0)
 
-	return caps
+	// sessions established within restart time are treated as re-established
+	// after restart, peers keep stale routes until End-of-RIB (RFC 4724)
+	return capabilities(p.grt, restartFlags{
+		restarting: p.kpt && time.Since(p.run) < p.grt,
+		preserved:  p.kpt,
+	}, p.saf)
 }
 
-func (p *plugin) OnOpenMessage(peer corebgp.PeerConfig, _ netip.Addr, _ []corebgp.Capability) *corebgp.Notification {
-	p.Infow("peer open message", zap.Any("peer", peer))
+func (p *plugin) OnOpenMessage(peer corebgp.PeerConfig, _ netip.Addr, caps []corebgp.Capability) *corebgp.Notification {
+	out, notification := negotiate(peer, caps, p.saf)
+	if notification != nil {
+		p.Warnw("reject peer with incompatible capabilities",
+			zap.Any("peer", peer),
+			zap.Any("capabilities", out))
+
+		return notification
+	}
+
+	p.Infow("peer open message",
+		zap.Any("peer", peer),
+		zap.Any("capabilities", out))
+
+	p.mu.Lock()
+	p.cps[peer.RemoteAddress] = out
+	p.mu.Unlock()
 
 	return nil
 }
 
 func (p *plugin) OnEstablished(peer corebgp.PeerConfig, writer corebgp.UpdateMessageWriter) corebgp.UpdateMessageHandler {
 	p.Infow("peer established", zap.Any("peer", peer))
-	p.rec.AddPeer(peer.RemoteAddress.String(), writer)
+	p.rec.AddPeer(broadcast.Peer{
+		Name:     peer.RemoteAddress.String(),
+		LocalAS:  peer.LocalAS,
+		RemoteAS: peer.RemoteAS,
+		NextHop:  p.prs[peer.RemoteAddress].NextHop,
+		Caps:     p.negotiated(peer.RemoteAddress),
+	}, writer) // initial table and End-of-RIB are sent by broadcaster
 
-	time.Sleep(time.Second) // wait before send initial update
+	return p.handleUpdate
+}
 
-	// send End-of-Rib
-	if err := writer.WriteUpdate([]byte{0, 0, 0, 0}); err != nil {
-		return func(corebgp.PeerConfig, []byte) *corebgp.Notification {
-			return corebgp.UpdateNotificationFromErr(err)
-		}
-	}
+// handleUpdate ignores routes received from peer, we are a route source only.
+// corebgp delivers UPDATE messages only, ROUTE-REFRESH (RFC 2918) is consumed
+// by refreshConn, that replays the table through broadcast.Refresher.
+func (p *plugin) handleUpdate(peer corebgp.PeerConfig, msg []byte) *corebgp.Notification {
+	p.Debugw("ignore peer update",
+		zap.String("peer", peer.RemoteAddress.String()),
+		zap.Int("size", len(msg)))
 
-	return nil // ignore client updates
+	return nil
 }
 
 func (p *plugin) OnClose(peer corebgp.PeerConfig) {
 	p.Infow("peer closed", zap.Any("peer", peer))
 
 	p.rec.DelPeer(peer.RemoteAddress.String())
+
+	p.mu.Lock()
+	delete(p.cps, peer.RemoteAddress)
+	p.mu.Unlock()
 }
@@ -0,0 +1,241 @@
+package bgp
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/im-kulikov/go-bones/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// headerLen is the length of BGP message header (RFC 4271).
+	headerLen = 19
+
+	// maxMessageLen is the maximum length of BGP message without
+	// extended message capability, that is not advertised.
+	maxMessageLen = 4096
+
+	// msgRouteRefresh is the type of ROUTE-REFRESH message (RFC 2918).
+	msgRouteRefresh = 5
+
+	defaultPort = 179
+	dialTimeout = time.Second * 10
+)
+
+// connectRetryTime is a delay between connection attempts to active peer.
+var connectRetryTime = time.Second * 5
+
+// refreshConn passes BGP messages read from conn to corebgp, except
+// ROUTE-REFRESH ones: corebgp doesn't support them, so they're consumed
+// here and the table is replayed to the peer by fn.
+type refreshConn struct {
+	net.Conn
+
+	fn  func()
+	tmp []byte
+
+	// in are bytes read from conn, out are bytes of messages passed to reader
+	in  []byte
+	out []byte
+
+	// raw is set when framing is lost, corebgp reports the error to the peer
+	raw bool
+
+	once sync.Once
+	done chan struct{}
+}
+
+func newRefreshConn(conn net.Conn, fn func()) *refreshConn {
+	return &refreshConn{Conn: conn, fn: fn, tmp: make([]byte, maxMessageLen), done: make(chan struct{})}
+}
+
+// next returns the next message, that should be passed to corebgp.
+func (c *refreshConn) next() ([]byte, error) {
+	for {
+		if len(c.in) >= headerLen {
+			size := int(binary.BigEndian.Uint16(c.in[16:18]))
+			if size < headerLen || size > maxMessageLen {
+				c.raw = true
+
+				out := c.in
+				c.in = nil
+
+				return out, nil
+			}
+
+			if len(c.in) >= size {
+				msg := c.in[:size:size]
+				if c.in = c.in[size:]; msg[18] != msgRouteRefresh {
+					return msg, nil
+				}
+
+				c.fn()
+
+				continue
+			}
+		}
+
+		// partially read message is kept until the next call
+		n, err := c.Conn.Read(c.tmp)
+		if c.in = append(c.in, c.tmp[:n]...); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *refreshConn) Read(p []byte) (int, error) {
+	for len(c.out) == 0 {
+		if c.raw {
+			if len(c.in) > 0 {
+				c.out, c.in = c.in, nil
+
+				break
+			}
+
+			return c.Conn.Read(p)
+		}
+
+		msg, err := c.next()
+		if err != nil {
+			return 0, err
+		}
+
+		c.out = msg
+	}
+
+	n := copy(p, c.out)
+	c.out = c.out[n:]
+
+	return n, nil
+}
+
+func (c *refreshConn) Close() error {
+	c.once.Do(func() { close(c.done) })
+
+	return c.Conn.Close()
+}
+
+// refreshListener wraps accepted connections of passive peers.
+type refreshListener struct {
+	net.Listener
+
+	wrap func(net.Conn) *refreshConn
+}
+
+func (l *refreshListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return l.wrap(conn), nil
+}
+
+// dialListener connects to active peers and passes connections to corebgp
+// as accepted ones, so every session is read through refreshConn. corebgp
+// treats all peers as passive ones, it doesn't dial them itself.
+type dialListener struct {
+	log  logger.Logger
+	rid  netip.Addr
+	wrap func(net.Conn) *refreshConn
+
+	once  sync.Once
+	done  chan struct{}
+	conns chan net.Conn
+}
+
+func newDialListener(log logger.Logger, rid netip.Addr, wrap func(net.Conn) *refreshConn) *dialListener {
+	return &dialListener{
+		log:  log,
+		rid:  rid,
+		wrap: wrap,
+
+		done:  make(chan struct{}),
+		conns: make(chan net.Conn),
+	}
+}
+
+func (d *dialListener) Accept() (net.Conn, error) {
+	select {
+	case <-d.done:
+		return nil, net.ErrClosed
+	case conn := <-d.conns:
+		return conn, nil
+	}
+}
+
+func (d *dialListener) Close() error {
+	d.once.Do(func() { close(d.done) })
+
+	return nil
+}
+
+func (d *dialListener) Addr() net.Addr { return &net.TCPAddr{IP: d.rid.AsSlice()} }
+
+// dial keeps connection to the peer until listener is closed, the peer is
+// dialed again after the session is closed.
+func (d *dialListener) dial(peer PeerConfig) {
+	port := defaultPort
+	if peer.Port != 0 {
+		port = peer.Port
+	}
+
+	dialer := net.Dialer{
+		Timeout:   dialTimeout,
+		LocalAddr: &net.TCPAddr{IP: d.rid.AsSlice()},
+		Control:   md5Control(peer),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-d.done:
+			cancel()
+		}
+	}()
+
+	address := net.JoinHostPort(peer.Address.String(), strconv.Itoa(port))
+	for {
+		if conn, err := dialer.DialContext(ctx, "tcp", address); err != nil {
+			d.log.Debugw("could not connect to peer",
+				zap.String("peer", address),
+				zap.Error(err))
+		} else if !d.serve(d.wrap(conn)) {
+			return
+		}
+
+		select {
+		case <-d.done:
+			return
+		case <-time.After(connectRetryTime):
+		}
+	}
+}
+
+// serve passes connection to corebgp and waits until it's closed,
+// it returns false when listener is closed.
+func (d *dialListener) serve(conn *refreshConn) bool {
+	select {
+	case <-d.done:
+		_ = conn.Close()
+
+		return false
+	case d.conns <- conn:
+	}
+
+	select {
+	case <-d.done:
+		return false
+	case <-conn.done:
+		return true
+	}
+}
@@ -0,0 +1,152 @@
+package bgp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/im-kulikov/go-bones/logger"
+)
+
+// testMessage returns BGP message of the type with body of the size.
+func testMessage(kind uint8, body int) []byte {
+	out := bytes.Repeat([]byte{0xff}, 16)
+	out = binary.BigEndian.AppendUint16(out, uint16(headerLen+body))
+	out = append(out, kind)
+
+	return append(out, make([]byte, body)...)
+}
+
+func TestRefreshConn(t *testing.T) {
+	open := testMessage(1, 10)
+	refresh := testMessage(msgRouteRefresh, 4)
+	keepalive := testMessage(4, 0)
+
+	cases := []struct {
+		name    string
+		stream  []byte
+		want    []byte
+		refresh int32
+	}{
+		{
+			name:    "refresh is consumed",
+			stream:  bytes.Join([][]byte{open, refresh, keepalive, refresh}, nil),
+			want:    append(append([]byte(nil), open...), keepalive...),
+			refresh: 2,
+		},
+		{
+			name:   "invalid length is passed as is",
+			stream: append(testMessage(4, 0)[:16], 0, 5, 4, 1, 2, 3),
+			want:   append(testMessage(4, 0)[:16], 0, 5, 4, 1, 2, 3),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			local, remote := net.Pipe()
+			defer func() { _ = remote.Close() }()
+
+			var calls atomic.Int32
+			conn := newRefreshConn(local, func() { calls.Add(1) })
+			defer func() { _ = conn.Close() }()
+
+			// messages are split, so they're read partially
+			go func() {
+				for i := 0; i < len(tc.stream); i += 7 {
+					_, _ = remote.Write(tc.stream[i:min(i+7, len(tc.stream))])
+				}
+
+				_ = remote.Close()
+			}()
+
+			got, err := io.ReadAll(conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(got, tc.want) {
+				t.Fatalf("expected %x, got %x", tc.want, got)
+			}
+
+			if n := calls.Load(); n != tc.refresh {
+				t.Fatalf("expected %d refreshes, got %d", tc.refresh, n)
+			}
+		})
+	}
+}
+
+func TestDialListener(t *testing.T) {
+	delay := connectRetryTime
+	connectRetryTime = time.Millisecond * 10
+	defer func() { connectRetryTime = delay }()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { _ = lis.Close() }()
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				_, _ = io.Copy(io.Discard, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(lis.Addr().String())
+	peer := PeerConfig{Address: netip.MustParseAddr("127.0.0.1")}
+	if peer.Port, err = strconv.Atoi(port); err != nil {
+		t.Fatal(err)
+	}
+
+	dls := newDialListener(logger.ForTests(t), peer.Address, func(conn net.Conn) *refreshConn {
+		return newRefreshConn(conn, func() {})
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		dls.dial(peer)
+	}()
+
+	// peer is dialed again after session is closed
+	for i := 0; i < 2; i++ {
+		conn, err := dls.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if conn.RemoteAddr().String() != lis.Addr().String() {
+			t.Fatalf("expected connection to %s, got %s", lis.Addr(), conn.RemoteAddr())
+		}
+
+		_ = conn.Close()
+	}
+
+	_ = dls.Close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("dialer was not stopped")
+	}
+
+	if _, err = dls.Accept(); err == nil {
+		t.Fatal("expected closed listener")
+	}
+}
@@ -5,11 +5,17 @@ import (
 	"github.com/im-kulikov/go-bones/logger"
 	"github.com/jwhited/corebgp"
 	"go.uber.org/zap"
+	"net"
 	"net/netip"
+	"syscall"
+	"time"
 )
 
 type Config struct {
 	Clients    []string         `env:"CLIENTS" default:""`
+	Peers      []string         `env:"PEERS" default:""`
+	LocalAS    uint32           `env:"LOCAL_AS" default:"65000"`
+	Restart    time.Duration    `env:"GRACEFUL_RESTART" default:"120s"`
 	Enabled    bool             `env:"ENABLED" default:"true"`
 	Network    string           `env:"NETWORK" default:"tcp"`
 	Address    string           `env:"ADDRESS" default:":51179"`
@@ -20,13 +26,40 @@ type Config struct {
 type server struct {
 	cfg Config
 	log logger.Logger
+	rec broadcast.Refresher
 	srv *corebgp.Server
+	prs []PeerConfig
+
+	// dls dials active peers, corebgp accepts their connections
+	dls *dialListener
+}
+
+// md5Control sets TCP MD5 signature (RFC 2385) of peers on the socket.
+func md5Control(peers ...PeerConfig) func(network, address string, c syscall.RawConn) error {
+	return func(_, _ string, c syscall.RawConn) error {
+		var err error
+		if ctrlErr := c.Control(func(fd uintptr) {
+			for _, peer := range peers {
+				if peer.Password == "" {
+					continue
+				}
+
+				if err = corebgp.SetTCPMD5Signature(int(fd), peer.Address,
+					uint8(peer.Address.BitLen()), peer.Password); err != nil {
+					return
+				}
+			}
+		}); ctrlErr != nil {
+			return ctrlErr
+		}
+
+		return err
+	}
 }
 
 // New creates a new BGP server.
 func New(cfg Config, log logger.Logger, rec broadcast.PeerManager) (Interface, error) {
 	var err error
-	handler := newPlugin(log, rec)
 	log.Infow("bgp server", zap.Any("config", cfg))
 
 	var rid netip.Addr
@@ -34,24 +67,67 @@ func New(cfg Config, log logger.Logger, rec broadcast.PeerManager) (Interface, e
 		return nil, err
 	}
 
+	if err = cfg.Attributes.Validate(); err != nil {
+		return nil, err
+	}
+
+	var peers []PeerConfig
+	if peers, err = ParsePeers(cfg); err != nil {
+		return nil, err
+	}
+
 	var srv *corebgp.Server
 	if srv, err = corebgp.NewServer(rid); err != nil {
 		return nil, err
 	}
 
-	for _, client := range cfg.Clients {
+	handler := newPlugin(log, rec, peers, cfg)
+	for _, peer := range peers {
 		conf := corebgp.PeerConfig{
-			RemoteAddress: netip.MustParseAddr(client),
-			LocalAS:       65000,
-			RemoteAS:      65000,
+			RemoteAddress: peer.Address,
+			LocalAS:       peer.LocalAS,
+			RemoteAS:      peer.RemoteAS,
+		}
+
+		// active peers are dialed by dialListener, so corebgp only accepts
+		// connections, that are read through refreshConn
+		opts := []corebgp.PeerOption{
+			corebgp.WithLocalAddress(rid),
+			corebgp.WithHoldTime(peer.HoldTime),
+			corebgp.WithPassive(),
 		}
 
-		log.Infow("adding peer", zap.Any("peer", conf), zap.String("router_id", cfg.RouteID))
+		log.Infow("adding peer",
+			zap.Any("peer", conf),
+			zap.Bool("external", peer.External()),
+			zap.Bool("passive", peer.Passive),
+			zap.Bool("md5", peer.Password != ""),
+			zap.String("router_id", cfg.RouteID))
 
-		if err = srv.AddPeer(conf, handler, corebgp.WithLocalAddress(rid), corebgp.WithPassive()); err != nil {
+		if err = srv.AddPeer(conf, handler, opts...); err != nil {
 			return nil, err
 		}
 	}
 
-	return &server{cfg: cfg, log: log, srv: srv}, nil
+	out := &server{cfg: cfg, log: log, rec: rec, srv: srv, prs: peers}
+	out.dls = newDialListener(log, rid, out.wrap)
+
+	return out, nil
+}
+
+// wrap returns connection, that answers ROUTE-REFRESH of the peer
+// by replaying the table.
+func (s *server) wrap(conn net.Conn) *refreshConn {
+	peer := conn.RemoteAddr().String()
+	if addr, err := netip.ParseAddrPort(peer); err == nil {
+		peer = addr.Addr().Unmap().String()
+	}
+
+	return newRefreshConn(conn, func() {
+		s.log.Infow("peer requested route refresh", zap.String("peer", peer))
+
+		if !s.rec.Refresh(peer) {
+			s.log.Warnw("could not refresh routes of unknown peer", zap.String("peer", peer))
+		}
+	})
 }
@@ -0,0 +1,198 @@
+package broadcast
+
+import (
+	"fmt"
+	"github.com/osrg/gobgp/pkg/packet/bgp"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Attributes overrides path attributes of prefixes resolved for a domain.
+// Empty values mean defaults of Config and peer.
+type Attributes struct {
+	Communities      []string `json:"communities,omitempty"`
+	LargeCommunities []string `json:"large_communities,omitempty"`
+	LocalPref        *uint32  `json:"local_pref,omitempty"`
+	MED              *uint32  `json:"med,omitempty"`
+	NextHop          string   `json:"next_hop,omitempty"`
+	NextHop6         string   `json:"next_hop6,omitempty"`
+
+	// PrefixLen limits summarization of addresses, see Config.Aggregate
+	PrefixLen  *uint8 `json:"prefix_len,omitempty"`
+	PrefixLen6 *uint8 `json:"prefix_len6,omitempty"`
+}
+
+// ParseDomain parses domain with optional attributes, like:
+//
+//	netflix.com;community=65000:100 65000:200;large=65000:1:1;local_pref=200;med=10;next_hop=10.0.0.1;prefix=22
+//
+// Several communities are separated by spaces.
+func ParseDomain(item string) (string, Attributes, error) {
+	var out Attributes
+
+	domain, options, _ := strings.Cut(strings.TrimSpace(item), ";")
+	if domain = strings.TrimSpace(domain); domain == "" {
+		return "", out, fmt.Errorf("domain %q: empty name", item)
+	}
+
+	for _, pair := range strings.Split(options, ";") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok {
+			return "", out, fmt.Errorf("domain %q: invalid option %q", item, pair)
+		}
+
+		val = strings.TrimSpace(val)
+		switch strings.TrimSpace(key) {
+		case "community":
+			out.Communities = strings.Fields(val)
+		case "large":
+			out.LargeCommunities = strings.Fields(val)
+		case "local_pref":
+			num, err := strconv.ParseUint(val, 10, 32)
+			if err != nil {
+				return "", out, fmt.Errorf("domain %q: local_pref: %w", item, err)
+			}
+
+			pref := uint32(num)
+			out.LocalPref = &pref
+		case "med":
+			num, err := strconv.ParseUint(val, 10, 32)
+			if err != nil {
+				return "", out, fmt.Errorf("domain %q: med: %w", item, err)
+			}
+
+			med := uint32(num)
+			out.MED = &med
+		case "prefix", "prefix6":
+			num, err := strconv.ParseUint(val, 10, 8)
+			if err != nil {
+				return "", out, fmt.Errorf("domain %q: %s: %w", item, key, err)
+			}
+
+			bits := uint8(num)
+			if key == "prefix" {
+				out.PrefixLen = &bits
+			} else {
+				out.PrefixLen6 = &bits
+			}
+		case "next_hop":
+			out.NextHop = val
+		case "next_hop6":
+			out.NextHop6 = val
+		default:
+			return "", out, fmt.Errorf("domain %q: unknown option %q", item, key)
+		}
+	}
+
+	return domain, out, out.Validate()
+}
+
+// Validate checks communities and next-hops.
+func (a Attributes) Validate() error {
+	if _, err := a.communities(); err != nil {
+		return err
+	}
+
+	if _, err := a.largeCommunities(); err != nil {
+		return err
+	}
+
+	if a.PrefixLen != nil && *a.PrefixLen > 32 {
+		return fmt.Errorf("invalid IPv4 prefix length %d", *a.PrefixLen)
+	}
+
+	if a.PrefixLen6 != nil && *a.PrefixLen6 > 128 {
+		return fmt.Errorf("invalid IPv6 prefix length %d", *a.PrefixLen6)
+	}
+
+	if addr, err := netip.ParseAddr(a.NextHop); a.NextHop != "" && (err != nil || !addr.Is4()) {
+		return fmt.Errorf("invalid IPv4 next-hop %q", a.NextHop)
+	}
+
+	if addr, err := netip.ParseAddr(a.NextHop6); a.NextHop6 != "" && (err != nil || !addr.Is6()) {
+		return fmt.Errorf("invalid IPv6 next-hop %q", a.NextHop6)
+	}
+
+	return nil
+}
+
+// communities parses standard communities in ASN:VALUE format (RFC 1997).
+func (a Attributes) communities() ([]uint32, error) {
+	out := make([]uint32, 0, len(a.Communities))
+	for _, item := range a.Communities {
+		high, low, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid community %q", item)
+		}
+
+		asn, err := strconv.ParseUint(high, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid community %q: %w", item, err)
+		}
+
+		var val uint64
+		if val, err = strconv.ParseUint(low, 10, 16); err != nil {
+			return nil, fmt.Errorf("invalid community %q: %w", item, err)
+		}
+
+		out = append(out, uint32(asn)<<16|uint32(val))
+	}
+
+	return out, nil
+}
+
+// largeCommunities parses large communities in GLOBAL:LOCAL1:LOCAL2 format (RFC 8092).
+func (a Attributes) largeCommunities() ([]*bgp.LargeCommunity, error) {
+	out := make([]*bgp.LargeCommunity, 0, len(a.LargeCommunities))
+	for _, item := range a.LargeCommunities {
+		community, err := bgp.ParseLargeCommunity(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid large community %q: %w", item, err)
+		}
+
+		out = append(out, community)
+	}
+
+	return out, nil
+}
+
+// Equal returns true when attributes are the same, order of communities is ignored.
+func (a Attributes) Equal(b Attributes) bool { return a.key() == b.key() }
+
+// key returns string, that is equal for equal attributes.
+func (a Attributes) key() string {
+	communities := append([]string(nil), a.Communities...)
+	sort.Strings(communities)
+
+	large := append([]string(nil), a.LargeCommunities...)
+	sort.Strings(large)
+
+	var pref, med, bits, bits6 string
+	if a.LocalPref != nil {
+		pref = strconv.FormatUint(uint64(*a.LocalPref), 10)
+	}
+
+	if a.MED != nil {
+		med = strconv.FormatUint(uint64(*a.MED), 10)
+	}
+
+	if a.PrefixLen != nil {
+		bits = strconv.FormatUint(uint64(*a.PrefixLen), 10)
+	}
+
+	if a.PrefixLen6 != nil {
+		bits6 = strconv.FormatUint(uint64(*a.PrefixLen6), 10)
+	}
+
+	return strings.Join([]string{
+		strings.Join(communities, " "),
+		strings.Join(large, " "),
+		pref, med, a.NextHop, a.NextHop6, bits, bits6,
+	}, ";")
+}
@@ -0,0 +1,55 @@
+package broadcast
+
+import "testing"
+
+func TestParseDomain(t *testing.T) {
+	cases := []struct {
+		name   string
+		item   string
+		domain string
+		key    string
+		fail   bool
+	}{
+		{name: "plain", item: " netflix.com ", domain: "netflix.com", key: ";;;;;;;"},
+		{
+			name:   "every option",
+			item:   "netflix.com;community=65000:200 65000:100;large=65000:1:1;local_pref=200;med=10;next_hop=10.0.0.1;next_hop6=fd00::1;prefix=22;prefix6=48",
+			domain: "netflix.com",
+			key:    "65000:100 65000:200;65000:1:1;200;10;10.0.0.1;fd00::1;22;48",
+		},
+		{name: "empty options", item: "netflix.com;; ;", domain: "netflix.com", key: ";;;;;;;"},
+		{name: "empty name", item: ";med=10", fail: true},
+		{name: "option without value", item: "netflix.com;med", fail: true},
+		{name: "unknown option", item: "netflix.com;weight=10", fail: true},
+		{name: "invalid med", item: "netflix.com;med=-1", fail: true},
+		{name: "invalid local_pref", item: "netflix.com;local_pref=high", fail: true},
+		{name: "invalid community", item: "netflix.com;community=65536:1", fail: true},
+		{name: "community without value", item: "netflix.com;community=65000", fail: true},
+		{name: "invalid large community", item: "netflix.com;large=65000:1", fail: true},
+		{name: "long prefix", item: "netflix.com;prefix=33", fail: true},
+		{name: "long prefix6", item: "netflix.com;prefix6=129", fail: true},
+		{name: "ipv6 next-hop", item: "netflix.com;next_hop=fd00::1", fail: true},
+		{name: "ipv4 next-hop6", item: "netflix.com;next_hop6=10.0.0.1", fail: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			domain, attrs, err := ParseDomain(tc.item)
+			if tc.fail {
+				if err == nil {
+					t.Fatalf("expected error, got %q %+v", domain, attrs)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			} else if domain != tc.domain {
+				t.Fatalf("expected domain %q, got %q", tc.domain, domain)
+			} else if key := attrs.key(); key != tc.key {
+				t.Fatalf("expected attributes %q, got %q", tc.key, key)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package broadcast
+
+import (
+	"fmt"
+	"github.com/osrg/gobgp/pkg/packet/bgp"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Modes of broadcaster.
+const (
+	ModeUnicast  = "unicast"
+	ModeFlowSpec = "flowspec"
+)
+
+// FlowSpec returns true, when addresses are announced as FlowSpec rules
+// (RFC 8955, RFC 8956) instead of unicast routes.
+func (c Config) FlowSpec() bool { return c.Mode == ModeFlowSpec }
+
+// Validate checks broadcaster mode and FlowSpec action.
+func (c Config) Validate() error {
+	switch c.Mode {
+	case "", ModeUnicast:
+		return nil
+	case ModeFlowSpec:
+		_, err := c.action()
+
+		return err
+	default:
+		return fmt.Errorf("unknown broadcaster mode %q", c.Mode)
+	}
+}
+
+// action returns extended community of FlowSpec action:
+// "redirect=<route target>" redirects traffic into VRF,
+// "rate=<bytes per second>" limits traffic, zero rate drops it.
+func (c Config) action() (bgp.ExtendedCommunityInterface, error) {
+	name, value, _ := strings.Cut(c.Action, "=")
+
+	switch strings.TrimSpace(name) {
+	case "rate":
+		rate, err := strconv.ParseFloat(strings.TrimSpace(value), 32)
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("invalid FlowSpec traffic rate %q", value)
+		}
+
+		return bgp.NewTrafficRateExtended(0, float32(rate)), nil
+	case "redirect":
+		target, err := bgp.ParseRouteTarget(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid FlowSpec redirect target %q: %w", value, err)
+		}
+
+		switch rt := target.(type) {
+		case *bgp.TwoOctetAsSpecificExtended:
+			return bgp.NewRedirectTwoOctetAsSpecificExtended(rt.AS, rt.LocalAdmin), nil
+		case *bgp.FourOctetAsSpecificExtended:
+			return bgp.NewRedirectFourOctetAsSpecificExtended(rt.AS, rt.LocalAdmin), nil
+		case *bgp.IPv4AddressSpecificExtended:
+			return bgp.NewRedirectIPv4AddressSpecificExtended(rt.IPv4.String(), rt.LocalAdmin), nil
+		default:
+			return nil, fmt.Errorf("unsupported FlowSpec redirect target %q", value)
+		}
+	default:
+		return nil, fmt.Errorf("unknown FlowSpec action %q", c.Action)
+	}
+}
+
+// flowSize returns size of encoded rule: NLRI length, component type,
+// prefix length, offset (IPv6 only) and significant octets.
+func flowSize(prefix netip.Prefix) int {
+	if prefix.Addr().Is4() {
+		return 2 + nlriSize(prefix)
+	}
+
+	return 3 + nlriSize(prefix)
+}
+
+// flowRule returns FlowSpec rule, that matches destination prefix.
+func flowRule(prefix netip.Prefix) bgp.AddrPrefixInterface {
+	bits, addr := uint8(prefix.Bits()), prefix.Addr().String()
+	if prefix.Addr().Is4() {
+		return bgp.NewFlowSpecIPv4Unicast([]bgp.FlowSpecComponentInterface{
+			bgp.NewFlowSpecDestinationPrefix(bgp.NewIPAddrPrefix(bits, addr)),
+		})
+	}
+
+	return bgp.NewFlowSpecIPv6Unicast([]bgp.FlowSpecComponentInterface{
+		bgp.NewFlowSpecDestinationPrefix6(bgp.NewIPv6AddrPrefix(bits, addr), 0),
+	})
+}
+
+// announceFlow returns UPDATE messages with FlowSpec rules of the same family,
+// rules carry action of config as extended community.
+func (e encoder) announceFlow(attrs Attributes, list []netip.Prefix) ([][]byte, error) {
+	attributes, err := e.attributes(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	var action bgp.ExtendedCommunityInterface
+	if action, err = e.cfg.action(); err != nil {
+		return nil, err
+	}
+
+	attributes = append(attributes, bgp.NewPathAttributeExtendedCommunities(
+		[]bgp.ExtendedCommunityInterface{action}))
+
+	var size int
+	if size, err = attributesSize(attributes); err != nil {
+		return nil, err
+	}
+
+	var out [][]byte
+	for _, chunk := range chunks(list, e.limit()-headerSize-size-mpReachSize, flowSize) {
+		rules := make([]bgp.AddrPrefixInterface, 0, len(chunk))
+		for _, prefix := range chunk {
+			rules = append(rules, flowRule(prefix))
+		}
+
+		// FlowSpec rules have no next-hop
+		update := &bgp.BGPUpdate{PathAttributes: append(attributes[:len(attributes):len(attributes)],
+			bgp.NewPathAttributeMpReachNLRI("0.0.0.0", rules))}
+
+		if out, err = serialize(update, out); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// withdrawFlow returns UPDATE messages, that withdraw FlowSpec rules of the same family.
+func (e encoder) withdrawFlow(list []netip.Prefix) ([][]byte, error) {
+	var (
+		err error
+		out [][]byte
+	)
+
+	for _, chunk := range chunks(list, e.limit()-headerSize-mpUnreachSize, flowSize) {
+		rules := make([]bgp.AddrPrefixInterface, 0, len(chunk))
+		for _, prefix := range chunk {
+			rules = append(rules, flowRule(prefix))
+		}
+
+		update := &bgp.BGPUpdate{PathAttributes: []bgp.PathAttributeInterface{
+			bgp.NewPathAttributeMpUnreachNLRI(rules),
+		}}
+
+		if out, err = serialize(update, out); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
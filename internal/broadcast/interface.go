@@ -14,14 +14,56 @@ type Interface interface {
 }
 
 type PeerManager interface {
+	Refresher
+
 	DelPeer(string)
-	AddPeer(string, corebgp.UpdateMessageWriter)
+	AddPeer(Peer, corebgp.UpdateMessageWriter)
+}
+
+// Refresher replays current table to the peer (or to every peer, when empty).
+type Refresher interface {
+	Refresh(peer string) bool
+}
+
+// Peer describes established session, that receives updates.
+type Peer struct {
+	Name     string
+	LocalAS  uint32
+	RemoteAS uint32
+
+	// NextHop overrides Config.NextHop for the peer
+	NextHop string
+
+	// Caps are capabilities negotiated with the peer
+	Caps Capabilities
 }
 
+// Capabilities describes negotiated capabilities of BGP session.
+type Capabilities struct {
+	FourOctetAS     bool
+	IPv4Unicast     bool
+	IPv6Unicast     bool
+	IPv4FlowSpec    bool
+	IPv6FlowSpec    bool
+	GracefulRestart bool
+}
+
+// External returns true for eBGP sessions.
+func (p Peer) External() bool { return p.LocalAS != p.RemoteAS }
+
 type Broadcaster interface {
 	Broadcast(msg UpdateMessage)
 }
 
+// Fanout sends every message to each of broadcasters.
+type Fanout []Broadcaster
+
+func (f Fanout) Broadcast(msg UpdateMessage) {
+	for _, brd := range f {
+		brd.Broadcast(msg)
+	}
+}
+
 func (*server) Name() string { return "broadcaster" }
 
 func (s *server) Stop(context.Context) {}
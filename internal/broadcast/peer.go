@@ -0,0 +1,172 @@
+package broadcast
+
+import (
+	"github.com/jwhited/corebgp"
+	"net/netip"
+	"sort"
+)
+
+// peerState is an Adj-RIB-Out of the peer: routes, that were sent to the peer
+// with their attributes. Updates are computed as a difference between the
+// table and routes already advertised, so the peer receives exact changes.
+type peerState struct {
+	Peer
+	corebgp.UpdateMessageWriter
+
+	enc encoder
+	adj map[netip.Prefix]Attributes
+
+	// eor is true, when End-of-RIB was sent after the initial table
+	eor bool
+}
+
+func newPeerState(cfg Config, peer Peer, writer corebgp.UpdateMessageWriter) *peerState {
+	return &peerState{
+		Peer:                peer,
+		UpdateMessageWriter: writer,
+
+		enc: encoder{cfg: cfg, peer: peer},
+		adj: make(map[netip.Prefix]Attributes),
+	}
+}
+
+// eligible returns true, when route could be advertised to the peer:
+// address family is negotiated and IPv6 next-hop is known (FlowSpec rules
+// have no next-hop).
+func (p *peerState) eligible(prefix netip.Prefix, attrs Attributes) bool {
+	if p.enc.cfg.FlowSpec() {
+		return (prefix.Addr().Is4() && p.Caps.IPv4FlowSpec) || (prefix.Addr().Is6() && p.Caps.IPv6FlowSpec)
+	}
+
+	if prefix.Addr().Is4() {
+		return p.Caps.IPv4Unicast
+	}
+
+	return p.Caps.IPv6Unicast && p.enc.nextHop6(attrs) != ""
+}
+
+// diff returns routes to announce grouped by attributes and routes to withdraw.
+func (p *peerState) diff(routes map[netip.Prefix]Attributes) (map[string][]netip.Prefix, []netip.Prefix) {
+	var (
+		adds = make(map[string][]netip.Prefix)
+		dels []netip.Prefix
+	)
+
+	for prefix, attrs := range routes {
+		if !p.eligible(prefix, attrs) {
+			continue
+		}
+
+		key := attrs.key()
+		if old, ok := p.adj[prefix]; ok && old.key() == key {
+			continue
+		}
+
+		adds[key] = append(adds[key], prefix)
+	}
+
+	// changed attributes are replaced by announcement (implicit withdraw)
+	for prefix := range p.adj {
+		if cur, ok := routes[prefix]; !ok || !p.eligible(prefix, cur) {
+			dels = append(dels, prefix)
+		}
+	}
+
+	for _, list := range adds {
+		sortPrefixes(list)
+	}
+
+	sortPrefixes(dels)
+
+	return adds, dels
+}
+
+// sync sends difference between routes and Adj-RIB-Out, announcements go
+// before withdrawals. End-of-RIB is sent once, after the initial table.
+// It returns count of announced and withdrawn routes.
+func (p *peerState) sync(routes map[netip.Prefix]Attributes) (int, int, error) {
+	adds, dels := p.diff(routes)
+
+	var announced int
+	for _, list := range adds {
+		attrs := routes[list[0]]
+
+		v4, v6 := splitFamilies(list)
+		if err := p.write(p.enc.announce4(attrs, v4)); err != nil {
+			return announced, 0, err
+		}
+
+		if err := p.write(p.enc.announce6(attrs, v6)); err != nil {
+			return announced, 0, err
+		}
+
+		for _, prefix := range list {
+			p.adj[prefix] = attrs
+		}
+
+		announced += len(list)
+	}
+
+	v4, v6 := splitFamilies(dels)
+	if err := p.write(p.enc.withdraw4(v4)); err != nil {
+		return announced, 0, err
+	}
+
+	if err := p.write(p.enc.withdraw6(v6)); err != nil {
+		return announced, 0, err
+	}
+
+	for _, prefix := range dels {
+		delete(p.adj, prefix)
+	}
+
+	if !p.eor {
+		if err := p.write(p.enc.endOfRib()); err != nil {
+			return announced, len(dels), err
+		}
+
+		p.eor = true
+	}
+
+	return announced, len(dels), nil
+}
+
+// reset forgets Adj-RIB-Out, so next sync replays the whole table.
+func (p *peerState) reset() { p.adj = make(map[netip.Prefix]Attributes) }
+
+func (p *peerState) write(list [][]byte, err error) error {
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range list {
+		if err = p.WriteUpdate(msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// splitFamilies splits routes by address family.
+func splitFamilies(list []netip.Prefix) (v4, v6 []netip.Prefix) {
+	for _, prefix := range list {
+		if prefix.Addr().Is4() {
+			v4 = append(v4, prefix)
+		} else {
+			v6 = append(v6, prefix)
+		}
+	}
+
+	return v4, v6
+}
+
+func sortPrefixes(list []netip.Prefix) {
+	sort.Slice(list, func(i, j int) bool {
+		if c := list[i].Addr().Compare(list[j].Addr()); c != 0 {
+			return c < 0
+		}
+
+		return list[i].Bits() < list[j].Bits()
+	})
+}
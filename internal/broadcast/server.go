@@ -2,9 +2,8 @@ package broadcast
 
 import (
 	"context"
-	"github.com/containerd/containerd/pkg/atomic"
-	"github.com/osrg/gobgp/pkg/packet/bgp"
 	"go.uber.org/zap"
+	"net/netip"
 	"sync"
 	"time"
 
@@ -13,220 +12,357 @@ import (
 )
 
 type server struct {
-	sync.RWMutex
 	logger.Logger
 
 	cfg Config
-	ext atomic.Bool
-	act chan updatePeer
-	out chan UpdateMessage
+
+	// mu guards table, workers and closed flag, routes of the table are
+	// replaced on every change, so workers read them without the lock.
+	mu     sync.Mutex
+	rib    *table
+	peers  map[string]*worker
+	closed bool
+
+	// dty is notified when routes changed and should be persisted
+	dty chan struct{}
+	wg  sync.WaitGroup
+}
+
+// persistDelay coalesces changes of routes, so state file is not
+// rewritten on every change.
+const persistDelay = time.Second * 5
+
+// peerRetryDelay is a delay before resync of the peer, that failed to receive updates.
+var peerRetryDelay = time.Second * 5
+
+// worker sends updates to a single peer, so a slow peer doesn't stall others.
+type worker struct {
+	state *peerState
+
+	// dty is notified when routes changed, pending notifications are
+	// coalesced and the peer receives the latest table only.
+	dty  chan struct{}
+	stop chan struct{}
+
+	// rst is set when Adj-RIB-Out should be replayed, guarded by server mu
+	rst bool
 }
 
 // UpdateMessage represents a message to update the DNS records
 type UpdateMessage struct {
 	ToUpdate []string
 	ToRemove []string
-}
 
-type updatePeer struct {
-	Peer   string
-	Action action
-	writer corebgp.UpdateMessageWriter
+	// TTL is the time until the next update, zero when unknown
+	TTL time.Duration
+
+	// Attributes of updated addresses, missing means defaults
+	Attributes map[string]Attributes
 }
 
 type Config struct {
 	NextHop   string `env:"NEXT_HOP" default:"192.168.88.1"`
+	NextHop6  string `env:"NEXT_HOP6" default:""`
 	LocalPref uint32 `env:"LOCAL_PREF" default:"100"`
-}
-
-type action uint8
 
-const (
-	_ action = iota
-	addPeer
-	remPeer
-)
+	// Aggregate summarizes addresses into covering prefixes, that are not
+	// shorter than PrefixLen (PrefixLen6), once share of resolved addresses
+	// within the prefix reaches Density.
+	Aggregate  bool    `env:"AGGREGATE" default:"false"`
+	Density    float64 `env:"AGGREGATE_DENSITY" default:"0.5"`
+	PrefixLen  uint8   `env:"AGGREGATE_PREFIX_LEN" default:"24"`
+	PrefixLen6 uint8   `env:"AGGREGATE_PREFIX_LEN6" default:"64"`
+
+	// State is a file, where announced routes are persisted. Routes are
+	// restored on start and announced until resolved again or Stale expired,
+	// so peers keep them across restart (RFC 4724).
+	State string        `env:"STATE_FILE" default:""`
+	Stale time.Duration `env:"STALE_TIME" default:"120s"`
+
+	// Mode is "unicast" or "flowspec", in FlowSpec mode addresses are
+	// announced as destination-prefix rules with Action, that is either
+	// "redirect=<route target>" or "rate=<bytes per second>".
+	Mode   string `env:"MODE" default:"unicast"`
+	Action string `env:"FLOWSPEC_ACTION" default:"rate=0"`
+}
 
 func New(cfg Config, log logger.Logger) Interface {
+	rib := newTable(cfg)
+	if cfg.State != "" {
+		routes, err := loadState(cfg.State)
+		if err != nil {
+			log.Warnw("could not restore routes", zap.String("state", cfg.State), zap.Error(err))
+		} else if len(routes) > 0 {
+			log.Infow("restore routes", zap.String("state", cfg.State), zap.Int("routes", len(routes)))
+			rib.restore(routes)
+		}
+	}
+
 	return &server{
 		Logger: log,
 
-		cfg: cfg,
-		ext: atomic.NewBool(false),
-		act: make(chan updatePeer, 10),
-		out: make(chan UpdateMessage, 10),
+		cfg:   cfg,
+		rib:   rib,
+		dty:   make(chan struct{}, 1),
+		peers: make(map[string]*worker),
 	}
 }
 
 func (s *server) DelPeer(peer string) {
-	if s.ext.IsSet() {
-		return
-	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	s.act <- updatePeer{Peer: peer, Action: remPeer}
+	if w, ok := s.peers[peer]; ok {
+		s.Infow("remove peer writer", zap.String("peer", peer))
+
+		close(w.stop)
+		delete(s.peers, peer)
+	}
 }
 
-func (s *server) AddPeer(peer string, writer corebgp.UpdateMessageWriter) {
-	if s.ext.IsSet() {
+func (s *server) AddPeer(peer Peer, writer corebgp.UpdateMessageWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
 		return
 	}
 
-	s.act <- updatePeer{Peer: peer, Action: addPeer, writer: writer}
+	if old, ok := s.peers[peer.Name]; ok {
+		close(old.stop)
+	}
+
+	w := &worker{
+		state: newPeerState(s.cfg, peer, writer),
+		dty:   make(chan struct{}, 1),
+		stop:  make(chan struct{}),
+	}
+
+	s.peers[peer.Name] = w
+	w.notify()
+
+	s.wg.Add(1)
+	go s.run(w)
 }
 
-func (s *server) Broadcast(msg UpdateMessage) {
-	if s.ext.IsSet() {
-		return
+// Refresh replays current table to the peer, empty peer means every peer.
+// It returns false when there is no such established peer.
+func (s *server) Refresh(peer string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
 	}
 
-	s.out <- msg
+	var found bool
+	for name, w := range s.peers {
+		if peer != "" && peer != name {
+			continue
+		}
+
+		found = true
+		w.rst = true
+		w.notify()
+	}
+
+	return found || (peer == "" && len(s.peers) == 0)
 }
 
-func (s *server) updateList(list []string, msg UpdateMessage) []string {
+func (s *server) Broadcast(msg UpdateMessage) {
 	if len(msg.ToUpdate) == 0 && len(msg.ToRemove) == 0 {
-		return list
+		s.Debugw("ignore empty update")
+
+		return
 	}
 
-	s.Infow("before update",
-		zap.Int("msg.update", len(msg.ToUpdate)),
-		zap.Int("msg.remove", len(msg.ToRemove)),
-		zap.Int("list", len(list)))
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	// Создаем карту для отслеживания элементов списка
-	listMap := make(map[string]bool)
-	for _, item := range list {
-		listMap[item] = true
+	if s.closed {
+		return
 	}
 
-	// Удаляем элементы, которые должны быть удалены
-	for _, item := range msg.ToRemove {
-		delete(listMap, item)
+	before := len(s.rib.routes)
+	if msg = s.rib.apply(msg); len(msg.ToUpdate) == 0 && len(msg.ToRemove) == 0 {
+		return
 	}
 
-	// Добавляем новые элементы
-	for _, item := range msg.ToUpdate {
-		listMap[item] = true
+	s.Infow("routes updated",
+		zap.Int("addresses", len(s.rib.addrs)),
+		zap.Int("routes.before", before),
+		zap.Int("routes.after", len(s.rib.routes)))
+
+	s.changed()
+}
+
+// changed notifies workers and persists routes, must be called with lock held.
+func (s *server) changed() {
+	for _, w := range s.peers {
+		w.notify()
 	}
 
-	// Создаем обновленный список из карты
-	updatedList := make([]string, 0, len(listMap))
-	for item := range listMap {
-		updatedList = append(updatedList, item)
+	select {
+	case s.dty <- struct{}{}:
+	default:
 	}
+}
+
+// expire withdraws restored routes, that were not resolved again.
+func (s *server) expire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	s.Infow("after update",
-		zap.Int("msg.update", len(msg.ToUpdate)),
-		zap.Int("msg.remove", len(msg.ToRemove)),
-		zap.Int("list", len(updatedList)))
+	if msg := s.rib.expire(); len(msg.ToRemove) > 0 {
+		s.Infow("stale routes expired", zap.Int("removes", len(msg.ToRemove)))
 
-	return updatedList
+		s.changed()
+	}
 }
 
-func (s *server) sendInitialTables(writer corebgp.UpdateMessageWriter, msg UpdateMessage) error {
-	if len(msg.ToUpdate) == 0 && len(msg.ToRemove) == 0 {
-		return nil
+// persist saves announced routes, so they could be restored after restart.
+func (s *server) persist() {
+	if s.cfg.State == "" {
+		return
 	}
 
-	removes := make([]*bgp.IPAddrPrefix, 0, len(msg.ToRemove))
-	for _, address := range msg.ToRemove {
-		removes = append(removes, bgp.NewIPAddrPrefix(32, address))
+	s.mu.Lock()
+	routes := s.rib.routes
+	s.mu.Unlock()
+
+	if err := saveState(s.cfg.State, routes); err != nil {
+		s.Warnw("could not persist routes", zap.String("state", s.cfg.State), zap.Error(err))
 	}
+}
+
+func (w *worker) notify() {
+	select {
+	case w.dty <- struct{}{}:
+	default:
+	}
+}
+
+// snapshot returns current routes and resets replay flag of the worker.
+func (s *server) snapshot(w *worker) (map[netip.Prefix]Attributes, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rst := w.rst
+	w.rst = false
+
+	return s.rib.routes, rst
+}
 
-	attributes := make([]bgp.PathAttributeInterface, 0, 4)
-	attributes = append(attributes,
-		bgp.NewPathAttributeOrigin(bgp.BGP_ORIGIN_ATTR_TYPE_IGP),
-		bgp.NewPathAttributeAsPath([]bgp.AsPathParamInterface{}),
-		bgp.NewPathAttributeNextHop(s.cfg.NextHop),
-		bgp.NewPathAttributeLocalPref(s.cfg.LocalPref))
+// run sends routes to the peer until it's removed or broadcaster stopped.
+func (s *server) run(w *worker) {
+	defer s.wg.Done()
 
-	// send batches of 1000 updates
-	for i := 0; i < len(msg.ToUpdate); i += 1000 {
-		end := i + 1000
-		if end > len(msg.ToUpdate) {
-			end = len(msg.ToUpdate)
+	name := w.state.Name
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-w.dty:
 		}
 
-		updates := make([]*bgp.IPAddrPrefix, 0, len(msg.ToUpdate[i:end]))
-		for _, address := range msg.ToUpdate[i:end] {
-			updates = append(updates, bgp.NewIPAddrPrefix(32, address))
+		routes, rst := s.snapshot(w)
+		if rst {
+			w.state.reset()
 		}
 
-		out := &bgp.BGPUpdate{
-			WithdrawnRoutesLen:    uint16(len(removes)),
-			WithdrawnRoutes:       removes,
-			TotalPathAttributeLen: uint16(len(attributes)),
-			PathAttributes:        attributes,
-			NLRI:                  updates,
+		initial := !w.state.eor
+		updates, removes, err := w.state.sync(routes)
+
+		switch {
+		case initial:
+			s.Infow("send initial table",
+				zap.String("peer", name),
+				zap.Bool("external", w.state.External()),
+				zap.Int("updates", updates),
+				zap.Error(err))
+		case rst:
+			s.Infow("refresh peer table",
+				zap.String("peer", name),
+				zap.Int("updates", updates),
+				zap.Error(err))
+		default:
+			s.Infow("send update message",
+				zap.String("peer", name),
+				zap.Int("updates", updates),
+				zap.Int("removes", removes),
+				zap.Error(err))
 		}
 
-		if buf, err := out.Serialize(); err != nil {
-			return err
-		} else if err = writer.WriteUpdate(buf); err != nil {
-			return err
-		} else if err = writer.WriteUpdate([]byte{0, 0, 0, 0}); err != nil {
-			return err
+		if err == nil {
+			continue
 		}
 
-		removes = nil // remove withdrawn routes after the first batch
-	}
+		// Adj-RIB-Out of the failed group is unknown, so the whole table is
+		// replayed, when the peer is able to receive updates again
+		s.Warnw("could not send updates, peer will be resynced",
+			zap.String("peer", name),
+			zap.Stringer("delay", peerRetryDelay),
+			zap.Error(err))
 
-	return writer.WriteUpdate([]byte{0, 0, 0, 0})
+		s.mu.Lock()
+		w.rst = true
+		s.mu.Unlock()
+
+		select {
+		case <-w.stop:
+			return
+		case <-time.After(peerRetryDelay):
+			w.notify()
+		}
+	}
 }
 
+// Start persists routes and expires stale ones until shutdown,
+// then stops workers of every peer.
 func (s *server) Start(ctx context.Context) error {
-	var (
-		list []string
-		peer = make(map[string]corebgp.UpdateMessageWriter)
-	)
+	s.mu.Lock()
+	restored := len(s.rib.stale) > 0
+	s.mu.Unlock()
+
+	stale := time.NewTimer(s.cfg.Stale)
+	defer stale.Stop()
+
+	if !restored {
+		stale.Stop()
+	}
 
-	ticker := time.NewTimer(time.Minute)
-	defer ticker.Stop()
+	// flush is armed by the first change and persists routes after persistDelay
+	var flush <-chan time.Time
 
+loop:
 	for {
 		select {
 		case <-ctx.Done():
-			s.Infow("broadcaster stopped")
-
-			s.ext.Set()
-			close(s.act)
-			close(s.out)
-
-			return nil
-
-		case msg := <-s.act:
-			switch msg.Action {
-			case addPeer:
-				peer[msg.Peer] = msg.writer
-
-				err := s.sendInitialTables(msg.writer, UpdateMessage{ToUpdate: list})
-				s.Infow("send initial table",
-					zap.String("peer", msg.Peer),
-					zap.Int("updates", len(list)),
-					zap.Error(err))
-
-			case remPeer:
-				s.Infow("remove peer writer", zap.String("peer", msg.Peer))
-				delete(peer, msg.Peer)
-			default:
-				s.Infow("unknown Action", zap.Any("Action", msg))
-			}
-		case msg := <-s.out:
-			if len(msg.ToUpdate) == 0 && len(msg.ToRemove) == 0 {
-				s.Debugw("ignore empty update")
-
-				continue
+			break loop
+		case <-stale.C:
+			s.expire()
+		case <-s.dty:
+			if flush == nil {
+				flush = time.After(persistDelay)
 			}
+		case <-flush:
+			flush = nil
 
-			list = s.updateList(list, msg)
-
-			for client, writer := range peer {
-				err := s.sendInitialTables(writer, msg)
-				s.Infow("send update message",
-					zap.String("peer", client),
-					zap.Int("updates", len(msg.ToUpdate)),
-					zap.Int("removes", len(msg.ToRemove)),
-					zap.Error(err))
-			}
+			s.persist()
 		}
 	}
+
+	s.mu.Lock()
+	s.closed = true
+	for name, w := range s.peers {
+		close(w.stop)
+		delete(s.peers, name)
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	s.persist()
+	s.Infow("broadcaster stopped")
+
+	return nil
 }
@@ -0,0 +1,56 @@
+package broadcast
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/im-kulikov/go-bones/logger"
+)
+
+// flakyWriter fails the first write, like a session with full send buffer.
+type flakyWriter struct {
+	sync.Mutex
+
+	failed bool
+	out    chan []byte
+}
+
+func (f *flakyWriter) WriteUpdate(msg []byte) error {
+	f.Lock()
+	defer f.Unlock()
+
+	if !f.failed {
+		f.failed = true
+
+		return errors.New("write failed")
+	}
+
+	f.out <- msg
+
+	return nil
+}
+
+func TestPeerResyncAfterWriteError(t *testing.T) {
+	delay := peerRetryDelay
+	peerRetryDelay = time.Millisecond * 10
+	defer func() { peerRetryDelay = delay }()
+
+	srv := New(Config{NextHop: "10.255.0.1", LocalPref: 100}, logger.ForTests(t)).(*server)
+	srv.Broadcast(UpdateMessage{ToUpdate: []string{"10.0.0.1", "10.0.0.2"}})
+
+	writer := &flakyWriter{out: make(chan []byte, 10)}
+	srv.AddPeer(Peer{Name: "peer", LocalAS: 65000, RemoteAS: 65000, Caps: Capabilities{IPv4Unicast: true}}, writer)
+	defer srv.DelPeer("peer")
+
+	var count int
+	for count < 2 {
+		select {
+		case msg := <-writer.out:
+			count += countPrefixes(t, msg)
+		case <-time.After(time.Second):
+			t.Fatalf("routes were not resent after write error, got %d", count)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package broadcast
+
+import (
+	"encoding/json"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+)
+
+// stateRoute is a route of persisted table.
+type stateRoute struct {
+	Prefix     netip.Prefix `json:"prefix"`
+	Attributes Attributes   `json:"attributes"`
+}
+
+// loadState reads routes announced before restart, missing file means empty table.
+func loadState(path string) (map[netip.Prefix]Attributes, error) {
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var list []stateRoute
+	if err = json.Unmarshal(buf, &list); err != nil {
+		return nil, err
+	}
+
+	out := make(map[netip.Prefix]Attributes, len(list))
+	for _, route := range list {
+		if route.Prefix.IsValid() {
+			out[route.Prefix.Masked()] = route.Attributes
+		}
+	}
+
+	return out, nil
+}
+
+// saveState atomically replaces persisted table with routes.
+func saveState(path string, routes map[netip.Prefix]Attributes) error {
+	list := make([]stateRoute, 0, len(routes))
+	for prefix, attrs := range routes {
+		list = append(list, stateRoute{Prefix: prefix, Attributes: attrs})
+	}
+
+	buf, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+
+	var tmp *os.File
+	if tmp, err = os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*"); err != nil {
+		return err
+	}
+
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	// data is synced before rename, so crash never leaves truncated state
+	if _, err = tmp.Write(buf); err == nil {
+		err = tmp.Sync()
+	}
+
+	if err != nil {
+		_ = tmp.Close()
+
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,50 @@
+package broadcast
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestState(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "routes.json")
+
+	if routes, err := loadState(path); err != nil || routes != nil {
+		t.Fatalf("expected empty state, got %v (%v)", routes, err)
+	}
+
+	med := uint32(10)
+	want := map[netip.Prefix]Attributes{
+		netip.MustParsePrefix("10.0.0.0/24"): {MED: &med},
+		netip.MustParsePrefix("fd00::1/128"): {Communities: []string{"65000:1"}},
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := saveState(path, want); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	for prefix, attrs := range want {
+		if got[prefix].key() != attrs.key() {
+			t.Fatalf("expected %s with %q, got %q", prefix, attrs.key(), got[prefix].key())
+		}
+	}
+
+	// temporary files are removed after rename
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(files) != 1 {
+		t.Fatalf("expected state file only, got %d files", len(files))
+	}
+}
@@ -0,0 +1,212 @@
+package broadcast
+
+import (
+	"math"
+	"net/netip"
+	"sort"
+)
+
+// table keeps resolved addresses and routes announced for them. When
+// aggregation is enabled, dense addresses are summarized into covering
+// prefixes; routes are recomputed on every change, so withdrawals of
+// expired addresses are derived from the difference of route sets.
+type table struct {
+	cfg Config
+
+	// addrs are active addresses with their attributes
+	addrs map[netip.Addr]Attributes
+
+	// routes are announced prefixes with their attributes
+	routes map[netip.Prefix]Attributes
+
+	// stale are routes restored after restart, they are announced until
+	// expired or resolved again (RFC 4724)
+	stale map[netip.Prefix]Attributes
+}
+
+func newTable(cfg Config) *table {
+	return &table{
+		cfg:    cfg,
+		addrs:  make(map[netip.Addr]Attributes),
+		routes: make(map[netip.Prefix]Attributes),
+	}
+}
+
+// apply updates addresses and returns difference of announced routes.
+func (t *table) apply(msg UpdateMessage) UpdateMessage {
+	for _, address := range msg.ToRemove {
+		if addr, err := netip.ParseAddr(address); err == nil {
+			delete(t.addrs, addr.Unmap())
+		}
+	}
+
+	for _, address := range msg.ToUpdate {
+		if addr, err := netip.ParseAddr(address); err == nil {
+			t.addrs[addr.Unmap()] = msg.Attributes[address]
+		}
+	}
+
+	out := t.update()
+	out.TTL = msg.TTL
+
+	return out
+}
+
+// restore announces routes restored after restart as stale ones.
+func (t *table) restore(routes map[netip.Prefix]Attributes) {
+	t.stale = routes
+	t.update()
+}
+
+// expire withdraws stale routes, that were not resolved again.
+func (t *table) expire() UpdateMessage {
+	t.stale = nil
+
+	return t.update()
+}
+
+// update recomputes routes and returns their difference.
+func (t *table) update() UpdateMessage {
+	routes := t.summarize()
+	for prefix, attrs := range t.stale {
+		if _, ok := routes[prefix]; !ok {
+			routes[prefix] = attrs
+		}
+	}
+
+	out := UpdateMessage{Attributes: make(map[string]Attributes)}
+	for prefix := range t.routes {
+		if _, ok := routes[prefix]; !ok {
+			out.ToRemove = append(out.ToRemove, prefix.String())
+		}
+	}
+
+	for prefix, attrs := range routes {
+		if old, ok := t.routes[prefix]; ok && old.key() == attrs.key() {
+			continue
+		}
+
+		out.ToUpdate = append(out.ToUpdate, prefix.String())
+		out.Attributes[prefix.String()] = attrs
+	}
+
+	t.routes = routes
+
+	return out
+}
+
+// minBits returns the shortest prefix length addresses could be summarized to.
+func (t *table) minBits(addr netip.Addr, attrs Attributes) int {
+	switch {
+	case addr.Is4() && attrs.PrefixLen != nil:
+		return int(*attrs.PrefixLen)
+	case addr.Is4():
+		return int(t.cfg.PrefixLen)
+	case attrs.PrefixLen6 != nil:
+		return int(*attrs.PrefixLen6)
+	default:
+		return int(t.cfg.PrefixLen6)
+	}
+}
+
+// summarize returns routes of active addresses. Addresses are summarized
+// only with addresses of the same family and attributes.
+func (t *table) summarize() map[netip.Prefix]Attributes {
+	groups := make(map[string][]netip.Addr)
+	for addr, attrs := range t.addrs {
+		key := attrs.key()
+		if addr.Is6() {
+			key += "/6"
+		}
+
+		groups[key] = append(groups[key], addr)
+	}
+
+	out := make(map[netip.Prefix]Attributes, len(t.addrs))
+	for _, list := range groups {
+		attrs := t.addrs[list[0]]
+		for _, prefix := range t.collapse(list, t.minBits(list[0], attrs)) {
+			out[prefix] = attrs
+		}
+	}
+
+	return out
+}
+
+// collapse returns the shortest prefix for every address, that is not
+// shorter than minBits and where share of active addresses reaches density.
+// Prefixes, covered by another chosen prefix, are dropped.
+func (t *table) collapse(list []netip.Addr, minBits int) []netip.Prefix {
+	sort.Slice(list, func(i, j int) bool { return list[i].Less(list[j]) })
+
+	maxBits := list[0].BitLen()
+	if !t.cfg.Aggregate || minBits <= 0 || minBits >= maxBits {
+		out := make([]netip.Prefix, 0, len(list))
+		for _, addr := range list {
+			out = append(out, netip.PrefixFrom(addr, maxBits))
+		}
+
+		return out
+	}
+
+	// count returns number of addresses within the prefix
+	count := func(prefix netip.Prefix) int {
+		first := sort.Search(len(list), func(i int) bool { return !list[i].Less(prefix.Addr()) })
+
+		last := first
+		for last < len(list) && prefix.Contains(list[last]) {
+			last++
+		}
+
+		return last - first
+	}
+
+	chosen := make(map[netip.Prefix]struct{})
+	for _, addr := range list {
+		prefix := netip.PrefixFrom(addr, maxBits)
+		for bits := minBits; bits < maxBits; bits++ {
+			candidate, _ := addr.Prefix(bits)
+
+			found := count(candidate)
+			if found >= 2 && float64(found) >= t.cfg.Density*math.Ldexp(1, maxBits-bits) {
+				prefix = candidate
+
+				break
+			}
+		}
+
+		chosen[prefix] = struct{}{}
+	}
+
+	out := make([]netip.Prefix, 0, len(chosen))
+	for prefix := range chosen {
+		out = append(out, prefix)
+	}
+
+	// shorter prefixes first, so covered ones could be dropped
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Bits() != out[j].Bits() {
+			return out[i].Bits() < out[j].Bits()
+		}
+
+		return out[i].Addr().Less(out[j].Addr())
+	})
+
+	result := out[:0]
+	for _, prefix := range out {
+		covered := false
+		for _, parent := range result {
+			if parent.Overlaps(prefix) {
+				covered = true
+
+				break
+			}
+		}
+
+		if !covered {
+			result = append(result, prefix)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,143 @@
+package broadcast
+
+import (
+	"net/netip"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func sortedRoutes(list []string) []string {
+	out := append([]string{}, list...)
+	sort.Strings(out)
+
+	return out
+}
+
+func TestTableCollapse(t *testing.T) {
+	cases := []struct {
+		name  string
+		cfg   Config
+		addrs []string
+		want  []string
+	}{
+		{
+			name:  "disabled",
+			cfg:   Config{Density: 0.5, PrefixLen: 24},
+			addrs: []string{"10.0.0.1", "10.0.0.2"},
+			want:  []string{"10.0.0.1/32", "10.0.0.2/32"},
+		},
+		{
+			name:  "dense",
+			cfg:   Config{Aggregate: true, Density: 0.5, PrefixLen: 29},
+			addrs: []string{"10.0.0.3", "10.0.0.0", "10.0.0.1", "10.0.0.2"},
+			want:  []string{"10.0.0.0/29"},
+		},
+		{
+			name:  "partially dense",
+			cfg:   Config{Aggregate: true, Density: 0.5, PrefixLen: 29},
+			addrs: []string{"10.0.0.1", "10.0.0.2", "10.0.0.5"},
+			want:  []string{"10.0.0.0/30", "10.0.0.5/32"},
+		},
+		{
+			name:  "sparse",
+			cfg:   Config{Aggregate: true, Density: 0.5, PrefixLen: 24},
+			addrs: []string{"10.0.0.1", "10.0.0.200"},
+			want:  []string{"10.0.0.1/32", "10.0.0.200/32"},
+		},
+		{
+			name:  "ipv6",
+			cfg:   Config{Aggregate: true, Density: 0.5, PrefixLen6: 126},
+			addrs: []string{"fd00::1", "fd00::2"},
+			want:  []string{"fd00::/126"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tbl := newTable(tc.cfg)
+
+			list := make([]netip.Addr, 0, len(tc.addrs))
+			for _, item := range tc.addrs {
+				list = append(list, netip.MustParseAddr(item))
+			}
+
+			minBits := int(tc.cfg.PrefixLen)
+			if list[0].Is6() {
+				minBits = int(tc.cfg.PrefixLen6)
+			}
+
+			var got []string
+			for _, prefix := range tbl.collapse(list, minBits) {
+				got = append(got, prefix.String())
+			}
+
+			if got = sortedRoutes(got); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestTableWithdraw(t *testing.T) {
+	tbl := newTable(Config{Aggregate: true, Density: 0.5, PrefixLen: 30, PrefixLen6: 126})
+
+	pref := uint32(200)
+
+	steps := []struct {
+		name   string
+		msg    UpdateMessage
+		update []string
+		remove []string
+	}{
+		{
+			name:   "aggregate",
+			msg:    UpdateMessage{ToUpdate: []string{"10.0.0.1", "10.0.0.2"}},
+			update: []string{"10.0.0.0/30"},
+		},
+		{
+			name:   "another prefix",
+			msg:    UpdateMessage{ToUpdate: []string{"10.0.1.1"}},
+			update: []string{"10.0.1.1/32"},
+		},
+		{
+			name:   "split aggregate",
+			msg:    UpdateMessage{ToRemove: []string{"10.0.0.2"}},
+			update: []string{"10.0.0.1/32"},
+			remove: []string{"10.0.0.0/30"},
+		},
+		{
+			name: "changed attributes",
+			msg: UpdateMessage{
+				ToUpdate:   []string{"10.0.1.1"},
+				Attributes: map[string]Attributes{"10.0.1.1": {LocalPref: &pref}},
+			},
+			update: []string{"10.0.1.1/32"},
+		},
+		{
+			name: "unchanged",
+			msg:  UpdateMessage{ToUpdate: []string{"10.0.0.1"}},
+		},
+		{
+			name:   "withdraw all",
+			msg:    UpdateMessage{ToRemove: []string{"10.0.0.1", "10.0.1.1", "10.0.9.9"}},
+			remove: []string{"10.0.0.1/32", "10.0.1.1/32"},
+		},
+	}
+
+	for _, step := range steps {
+		out := tbl.apply(step.msg)
+
+		if got := sortedRoutes(out.ToUpdate); !reflect.DeepEqual(got, sortedRoutes(step.update)) {
+			t.Fatalf("%s: expected updates %v, got %v", step.name, step.update, got)
+		}
+
+		if got := sortedRoutes(out.ToRemove); !reflect.DeepEqual(got, sortedRoutes(step.remove)) {
+			t.Fatalf("%s: expected withdrawals %v, got %v", step.name, step.remove, got)
+		}
+	}
+
+	if len(tbl.routes) != 0 {
+		t.Fatalf("expected empty table, got %v", tbl.routes)
+	}
+}
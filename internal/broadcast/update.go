@@ -0,0 +1,329 @@
+package broadcast
+
+import (
+	"github.com/osrg/gobgp/pkg/packet/bgp"
+	"net/netip"
+)
+
+const (
+	// maxMessageSize is the BGP message limit (RFC 4271)
+	maxMessageSize = 4096
+
+	// headerSize is the size of BGP message header,
+	// lengths of withdrawn routes and path attributes take 2 bytes each.
+	headerSize = 19 + 2 + 2
+
+	// mpReachSize is the upper bound of MP_REACH_NLRI without NLRI:
+	// attribute header, AFI, SAFI, next-hop length, next-hop and reserved byte.
+	mpReachSize = 4 + 2 + 1 + 1 + 16 + 1
+
+	// mpUnreachSize is the upper bound of MP_UNREACH_NLRI without NLRI.
+	mpUnreachSize = 4 + 2 + 1
+)
+
+// asTrans is used in AS_PATH instead of 4-byte AS numbers (RFC 6793)
+const asTrans = 23456
+
+// encoder packs routes into UPDATE messages for the peer.
+type encoder struct {
+	cfg  Config
+	peer Peer
+}
+
+// limit returns maximal size of UPDATE message, extended messages (RFC 8654)
+// are not advertised, because corebgp doesn't accept them from peers.
+func (e encoder) limit() int { return maxMessageSize }
+
+// nlriSize returns size of encoded prefix: length byte and significant octets.
+func nlriSize(prefix netip.Prefix) int { return 1 + (prefix.Bits()+7)/8 }
+
+// chunks splits prefixes, so encoded prefixes of every chunk fit into budget.
+func chunks(list []netip.Prefix, budget int, sizeOf func(netip.Prefix) int) [][]netip.Prefix {
+	var (
+		out  [][]netip.Prefix
+		size int
+		from int
+	)
+
+	for i, prefix := range list {
+		if size+sizeOf(prefix) > budget && i > from {
+			out = append(out, list[from:i])
+			from, size = i, 0
+		}
+
+		size += sizeOf(prefix)
+	}
+
+	if from < len(list) {
+		out = append(out, list[from:])
+	}
+
+	return out
+}
+
+func serialize(update *bgp.BGPUpdate, out [][]byte) ([][]byte, error) {
+	buf, err := update.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(out, buf), nil
+}
+
+func attributesSize(list []bgp.PathAttributeInterface) (int, error) {
+	var size int
+	for _, attr := range list {
+		buf, err := attr.Serialize()
+		if err != nil {
+			return 0, err
+		}
+
+		size += len(buf)
+	}
+
+	return size, nil
+}
+
+// nextHop returns IPv4 next-hop: domain, peer or default one.
+func (e encoder) nextHop(attrs Attributes) string {
+	switch {
+	case attrs.NextHop != "":
+		return attrs.NextHop
+	case e.peer.NextHop != "":
+		return e.peer.NextHop
+	default:
+		return e.cfg.NextHop
+	}
+}
+
+// nextHop6 returns IPv6 next-hop, empty when it's not configured.
+func (e encoder) nextHop6(attrs Attributes) string {
+	if attrs.NextHop6 != "" {
+		return attrs.NextHop6
+	}
+
+	return e.cfg.NextHop6
+}
+
+// announce4 returns UPDATE messages with IPv4 NLRI, that share attributes.
+func (e encoder) announce4(attrs Attributes, list []netip.Prefix) ([][]byte, error) {
+	if e.cfg.FlowSpec() {
+		return e.announceFlow(attrs, list)
+	}
+
+	attributes, err := e.attributes(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes = append(attributes, bgp.NewPathAttributeNextHop(e.nextHop(attrs)))
+
+	var size int
+	if size, err = attributesSize(attributes); err != nil {
+		return nil, err
+	}
+
+	var out [][]byte
+	for _, chunk := range chunks(list, e.limit()-headerSize-size, nlriSize) {
+		updates := make([]*bgp.IPAddrPrefix, 0, len(chunk))
+		for _, prefix := range chunk {
+			updates = append(updates, bgp.NewIPAddrPrefix(uint8(prefix.Bits()), prefix.Addr().String()))
+		}
+
+		if out, err = serialize(&bgp.BGPUpdate{PathAttributes: attributes, NLRI: updates}, out); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// announce6 returns UPDATE messages with IPv6 NLRI in MP_REACH_NLRI (RFC 4760).
+func (e encoder) announce6(attrs Attributes, list []netip.Prefix) ([][]byte, error) {
+	if e.cfg.FlowSpec() {
+		return e.announceFlow(attrs, list)
+	}
+
+	attributes, err := e.attributes(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	var size int
+	if size, err = attributesSize(attributes); err != nil {
+		return nil, err
+	}
+
+	var out [][]byte
+	for _, chunk := range chunks(list, e.limit()-headerSize-size-mpReachSize, nlriSize) {
+		updates := make([]bgp.AddrPrefixInterface, 0, len(chunk))
+		for _, prefix := range chunk {
+			updates = append(updates, bgp.NewIPv6AddrPrefix(uint8(prefix.Bits()), prefix.Addr().String()))
+		}
+
+		update := &bgp.BGPUpdate{PathAttributes: append(attributes[:len(attributes):len(attributes)],
+			bgp.NewPathAttributeMpReachNLRI(e.nextHop6(attrs), updates))}
+
+		if out, err = serialize(update, out); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// withdraw4 returns UPDATE messages with IPv4 withdrawn routes.
+func (e encoder) withdraw4(list []netip.Prefix) ([][]byte, error) {
+	if e.cfg.FlowSpec() {
+		return e.withdrawFlow(list)
+	}
+
+	var (
+		err error
+		out [][]byte
+	)
+
+	for _, chunk := range chunks(list, e.limit()-headerSize, nlriSize) {
+		removes := make([]*bgp.IPAddrPrefix, 0, len(chunk))
+		for _, prefix := range chunk {
+			removes = append(removes, bgp.NewIPAddrPrefix(uint8(prefix.Bits()), prefix.Addr().String()))
+		}
+
+		if out, err = serialize(&bgp.BGPUpdate{WithdrawnRoutes: removes}, out); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// withdraw6 returns UPDATE messages with IPv6 routes in MP_UNREACH_NLRI.
+func (e encoder) withdraw6(list []netip.Prefix) ([][]byte, error) {
+	if e.cfg.FlowSpec() {
+		return e.withdrawFlow(list)
+	}
+
+	var (
+		err error
+		out [][]byte
+	)
+
+	for _, chunk := range chunks(list, e.limit()-headerSize-mpUnreachSize, nlriSize) {
+		removes := make([]bgp.AddrPrefixInterface, 0, len(chunk))
+		for _, prefix := range chunk {
+			removes = append(removes, bgp.NewIPv6AddrPrefix(uint8(prefix.Bits()), prefix.Addr().String()))
+		}
+
+		update := &bgp.BGPUpdate{PathAttributes: []bgp.PathAttributeInterface{
+			bgp.NewPathAttributeMpUnreachNLRI(removes),
+		}}
+
+		if out, err = serialize(update, out); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// endOfRib returns End-of-RIB markers of negotiated families (RFC 4724).
+func (e encoder) endOfRib() ([][]byte, error) {
+	var families []bgp.RouteFamily
+	switch {
+	case e.cfg.FlowSpec():
+		if e.peer.Caps.IPv4FlowSpec {
+			families = append(families, bgp.RF_FS_IPv4_UC)
+		}
+
+		if e.peer.Caps.IPv6FlowSpec {
+			families = append(families, bgp.RF_FS_IPv6_UC)
+		}
+	default:
+		if e.peer.Caps.IPv4Unicast {
+			families = append(families, bgp.RF_IPv4_UC)
+		}
+
+		if e.peer.Caps.IPv6Unicast {
+			families = append(families, bgp.RF_IPv6_UC)
+		}
+	}
+
+	out := make([][]byte, 0, len(families))
+	for _, family := range families {
+		if family == bgp.RF_IPv4_UC {
+			out = append(out, []byte{0, 0, 0, 0})
+
+			continue
+		}
+
+		buf, err := bgp.NewEndOfRib(family).Body.Serialize()
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, buf)
+	}
+
+	return out, nil
+}
+
+// attributes returns path attributes for the peer without next-hop, eBGP peers
+// receive local AS prepended to AS_PATH and no LOCAL_PREF.
+func (e encoder) attributes(attrs Attributes) ([]bgp.PathAttributeInterface, error) {
+	out := []bgp.PathAttributeInterface{bgp.NewPathAttributeOrigin(bgp.BGP_ORIGIN_ATTR_TYPE_IGP)}
+
+	local := uint16(asTrans)
+	if e.peer.LocalAS <= 0xffff {
+		local = uint16(e.peer.LocalAS)
+	}
+
+	switch {
+	case !e.peer.External():
+		pref := e.cfg.LocalPref
+		if attrs.LocalPref != nil {
+			pref = *attrs.LocalPref
+		}
+
+		out = append(out,
+			bgp.NewPathAttributeAsPath([]bgp.AsPathParamInterface{}),
+			bgp.NewPathAttributeLocalPref(pref))
+	case e.peer.Caps.FourOctetAS:
+		out = append(out, bgp.NewPathAttributeAsPath([]bgp.AsPathParamInterface{
+			bgp.NewAs4PathParam(bgp.BGP_ASPATH_ATTR_TYPE_SEQ, []uint32{e.peer.LocalAS}),
+		}))
+	default:
+		out = append(out, bgp.NewPathAttributeAsPath([]bgp.AsPathParamInterface{
+			bgp.NewAsPathParam(bgp.BGP_ASPATH_ATTR_TYPE_SEQ, []uint16{local}),
+		}))
+
+		if e.peer.LocalAS > 0xffff {
+			out = append(out, bgp.NewPathAttributeAs4Path([]*bgp.As4PathParam{
+				bgp.NewAs4PathParam(bgp.BGP_ASPATH_ATTR_TYPE_SEQ, []uint32{e.peer.LocalAS}),
+			}))
+		}
+	}
+
+	if attrs.MED != nil {
+		out = append(out, bgp.NewPathAttributeMultiExitDisc(*attrs.MED))
+	}
+
+	communities, err := attrs.communities()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(communities) > 0 {
+		out = append(out, bgp.NewPathAttributeCommunities(communities))
+	}
+
+	var large []*bgp.LargeCommunity
+	if large, err = attrs.largeCommunities(); err != nil {
+		return nil, err
+	}
+
+	if len(large) > 0 {
+		out = append(out, bgp.NewPathAttributeLargeCommunities(large))
+	}
+
+	return out, nil
+}
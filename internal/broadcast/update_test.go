@@ -0,0 +1,135 @@
+package broadcast
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/osrg/gobgp/pkg/packet/bgp"
+)
+
+func TestChunks(t *testing.T) {
+	list := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("10.1.0.0/16"),
+		netip.MustParsePrefix("10.1.1.0/24"),
+		netip.MustParsePrefix("10.1.1.1/32"),
+	}
+
+	cases := []struct {
+		name   string
+		budget int
+		want   []int
+	}{
+		{name: "single", budget: 100, want: []int{4}},
+		{name: "exact", budget: 2 + 3 + 4 + 5, want: []int{4}},
+		{name: "split", budget: 5, want: []int{2, 1, 1}},
+		{name: "too small", budget: 1, want: []int{1, 1, 1, 1}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []int
+			for _, chunk := range chunks(list, tc.budget, nlriSize) {
+				got = append(got, len(chunk))
+			}
+
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("expected chunks %v, got %v", tc.want, got)
+			}
+		})
+	}
+
+	if out := chunks(nil, 100, nlriSize); len(out) != 0 {
+		t.Fatalf("expected no chunks, got %v", out)
+	}
+}
+
+// countPrefixes decodes body of UPDATE message and returns number of
+// announced and withdrawn prefixes (or FlowSpec rules).
+func countPrefixes(t *testing.T, buf []byte) int {
+	t.Helper()
+
+	header := &bgp.BGPHeader{Type: bgp.BGP_MSG_UPDATE, Len: uint16(len(buf) + 19)}
+
+	msg, err := bgp.ParseBGPBody(header, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	update, ok := msg.Body.(*bgp.BGPUpdate)
+	if !ok {
+		t.Fatalf("expected UPDATE, got %T", msg.Body)
+	}
+
+	count := len(update.NLRI) + len(update.WithdrawnRoutes)
+	for _, attr := range update.PathAttributes {
+		switch attr := attr.(type) {
+		case *bgp.PathAttributeMpReachNLRI:
+			count += len(attr.Value)
+		case *bgp.PathAttributeMpUnreachNLRI:
+			count += len(attr.Value)
+		}
+	}
+
+	return count
+}
+
+func TestEncoderMessageSize(t *testing.T) {
+	v4 := make([]netip.Prefix, 0, 2000)
+	v6 := make([]netip.Prefix, 0, 2000)
+	for i := 0; i < 2000; i++ {
+		v4 = append(v4, netip.PrefixFrom(netip.AddrFrom4([4]byte{10, byte(i >> 8), byte(i), 1}), 32))
+		v6 = append(v6, netip.PrefixFrom(netip.AddrFrom16([16]byte{0xfd, 15: byte(i), 14: byte(i >> 8)}), 128))
+	}
+
+	attrs := Attributes{
+		Communities:      []string{"65000:1", "65000:2", "65000:3"},
+		LargeCommunities: []string{"65000:1:1", "65000:1:2"},
+	}
+
+	peer := Peer{LocalAS: 4200000000, RemoteAS: 65001}
+
+	unicast := encoder{cfg: Config{NextHop: "10.255.0.1", NextHop6: "fd00::ff", LocalPref: 100}, peer: peer}
+	flowspec := encoder{cfg: Config{NextHop: "10.255.0.1", Mode: ModeFlowSpec, Action: "rate=0"}, peer: peer}
+
+	cases := []struct {
+		name   string
+		list   []netip.Prefix
+		encode func([]netip.Prefix) ([][]byte, error)
+	}{
+		{name: "announce ipv4", list: v4, encode: func(list []netip.Prefix) ([][]byte, error) { return unicast.announce4(attrs, list) }},
+		{name: "announce ipv6", list: v6, encode: func(list []netip.Prefix) ([][]byte, error) { return unicast.announce6(attrs, list) }},
+		{name: "withdraw ipv4", list: v4, encode: unicast.withdraw4},
+		{name: "withdraw ipv6", list: v6, encode: unicast.withdraw6},
+		{name: "announce flowspec", list: v4, encode: func(list []netip.Prefix) ([][]byte, error) { return flowspec.announce4(attrs, list) }},
+		{name: "withdraw flowspec", list: v6, encode: flowspec.withdraw6},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := tc.encode(tc.list)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(out) < 2 {
+				t.Fatalf("expected several messages, got %d", len(out))
+			}
+
+			var count int
+			for _, buf := range out {
+				// message header is written by corebgp
+				if size := len(buf) + 19; size > maxMessageSize {
+					t.Fatalf("message of %d bytes exceeds %d", size, maxMessageSize)
+				}
+
+				count += countPrefixes(t, buf)
+			}
+
+			if count != len(tc.list) {
+				t.Fatalf("expected %d prefixes, got %d", len(tc.list), count)
+			}
+		})
+	}
+}
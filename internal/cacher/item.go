@@ -14,6 +14,9 @@ type CacheItem struct {
 	Expire uint32
 	Record []string
 
+	// Attrs are BGP attributes of resolved addresses
+	Attrs broadcast.Attributes
+
 	now time.Time
 	ext map[string]time.Time
 }
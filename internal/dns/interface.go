@@ -2,6 +2,7 @@ package dns
 
 import (
 	"context"
+	"strings"
 	"sync"
 	"time"
 
@@ -36,6 +37,9 @@ type server struct {
 	rec cacher.Interface
 	brd broadcast.Broadcaster
 
+	// att are attributes of domains, parsed from Domains or set through admin API
+	att map[string]broadcast.Attributes
+
 	cancel context.CancelFunc
 }
 
@@ -45,7 +49,27 @@ func New(cfg Config, log logger.Logger, brd broadcast.Broadcaster) (Interface, e
 		return nil, err
 	}
 
+	att := make(map[string]broadcast.Attributes, len(cfg.Domains))
+	domains := make([]string, 0, len(cfg.Domains))
+	for _, item := range cfg.Domains {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+
+		domain, attrs, err := broadcast.ParseDomain(item)
+		if err != nil {
+			return nil, err
+		}
+
+		att[domain] = attrs
+		domains = append(domains, domain)
+	}
+
+	cfg.Domains = domains
+
 	return &server{
+		att: att,
+
 		cancel: func() {},
 
 		cfg: cfg,
@@ -71,6 +95,7 @@ func (s *server) fetchDomains(ctx context.Context, ttl time.Duration) fetchResul
 	ptx, cancel := context.WithTimeout(ctx, time.Second*15)
 	defer cancel()
 
+	// buffered, so late resolvers never block after timeout
 	s.RLock()
 	out := make(chan fetchResult, len(s.cfg.Domains))
 	for _, domain := range s.cfg.Domains {
@@ -85,18 +110,21 @@ loop:
 	for {
 		select {
 		case <-ptx.Done():
-			close(out)
+			s.log.Infow("stop waiting for resolver response")
+
 			break loop
 
-		case res, ok := <-out:
-			if !ok {
-				s.log.Infow("stop waiting for resolver response")
+		case res := <-out:
+			msg.ToUpdate = append(msg.ToUpdate, res.msg.ToUpdate...)
+			msg.ToRemove = append(msg.ToRemove, res.msg.ToRemove...)
 
-				break loop
+			if msg.Attributes == nil {
+				msg.Attributes = make(map[string]broadcast.Attributes)
 			}
 
-			msg.ToUpdate = append(msg.ToUpdate, res.msg.ToUpdate...)
-			msg.ToRemove = append(msg.ToRemove, res.msg.ToRemove...)
+			for address, attrs := range res.msg.Attributes {
+				msg.Attributes[address] = attrs
+			}
 
 			// Update the TTL if it is greater than 10 seconds
 			if res.ttl < ttl && res.ttl > 0 && res.ttl > time.Second*10 {
@@ -112,6 +140,13 @@ loop:
 		}
 	}
 
+	owners := s.owners()
+	for address := range msg.Attributes {
+		if domain, ok := owners[address]; ok {
+			msg.Attributes[address] = s.attributes(domain)
+		}
+	}
+
 	return fetchResult{
 		ttl: ttl,
 		msg: msg,
@@ -142,6 +177,8 @@ func (s *server) Start(ctx context.Context) error {
 				zap.Stringer("spent", time.Since(now)))
 
 			ticker.Reset(cur.ttl)
+
+			cur.msg.TTL = cur.ttl
 			s.brd.Broadcast(cur.msg)
 		}
 	}
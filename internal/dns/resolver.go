@@ -10,6 +10,23 @@ import (
 	"go.uber.org/zap"
 )
 
+// announced returns every record of the domain with attributes,
+// when they were changed since records were announced.
+func (s *server) announced(rec *cacher.CacheItem, domain string) broadcast.UpdateMessage {
+	attrs := s.attributes(domain)
+	if attrs.Equal(rec.Attrs) {
+		return broadcast.UpdateMessage{}
+	}
+
+	rec.Attrs = attrs
+
+	s.log.Infow("attributes changed, announce records again",
+		zap.String("domain", domain),
+		zap.Strings("records", rec.Record))
+
+	return broadcast.UpdateMessage{ToUpdate: append([]string(nil), rec.Record...)}
+}
+
 func (s *server) resolve(ctx context.Context, out chan fetchResult, domain string) {
 	rec, ok := s.rec.Get(domain)
 	if !ok {
@@ -26,39 +43,55 @@ func (s *server) resolve(ctx context.Context, out chan fetchResult, domain strin
 			zap.String("domain", domain),
 			zap.Strings("records", rec.Record))
 
+		// caller waits for a result of every domain
+		res := s.announced(rec, domain)
+		res.Attributes = make(map[string]broadcast.Attributes, len(res.ToUpdate))
+		for _, address := range res.ToUpdate {
+			res.Attributes[address] = rec.Attrs
+		}
+
+		out <- fetchResult{msg: res}
+
 		return
 	}
 
-	query := dns.Question{Name: domain + ".", Qtype: dns.TypeA, Qclass: dns.ClassINET}
 	s.log.Debugw("trying to resolve",
 		zap.String("domain", domain),
 		zap.Uint32("ttl", rec.Expire))
 
 	var res broadcast.UpdateMessage
-	msg := &dns.Msg{
-		MsgHdr:   dns.MsgHdr{RecursionDesired: true},
-		Question: []dns.Question{query},
-	}
-
-	var err error
 	for _, srv := range s.cfg.Servers {
-		var result *dns.Msg
-		if result, err = dns.ExchangeContext(ctx, msg, srv); err != nil {
-			s.log.Debugw("could not resolve",
-				zap.String("domain", domain),
-				zap.String("server", srv),
-				zap.Error(err))
-
-			return
-		}
-
 		ttl := rec.Expire
 		var tmp []string
-		for _, rr := range result.Answer {
-			switch r := rr.(type) {
-			case *dns.A:
-				ttl = r.Hdr.Ttl
-				tmp = append(tmp, r.A.String())
+
+		// IPv6 addresses are announced over MP-BGP
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			msg := &dns.Msg{
+				MsgHdr:   dns.MsgHdr{RecursionDesired: true},
+				Question: []dns.Question{{Name: domain + ".", Qtype: qtype, Qclass: dns.ClassINET}},
+			}
+
+			// addresses of another type are still announced
+			result, err := dns.ExchangeContext(ctx, msg, srv)
+			if err != nil {
+				s.log.Warnw("could not resolve",
+					zap.String("domain", domain),
+					zap.String("server", srv),
+					zap.String("type", dns.TypeToString[qtype]),
+					zap.Error(err))
+
+				continue
+			}
+
+			for _, rr := range result.Answer {
+				switch r := rr.(type) {
+				case *dns.A:
+					ttl = r.Hdr.Ttl
+					tmp = append(tmp, r.A.String())
+				case *dns.AAAA:
+					ttl = r.Hdr.Ttl
+					tmp = append(tmp, r.AAAA.String())
+				}
 			}
 		}
 
@@ -67,6 +100,17 @@ func (s *server) resolve(ctx context.Context, out chan fetchResult, domain strin
 		res.ToRemove = append(res.ToRemove, upd.ToRemove...)
 	}
 
+	// attributes could be changed through admin API, then every record
+	// of the domain is announced, not only new ones
+	if upd := s.announced(rec, domain); len(upd.ToUpdate) > 0 {
+		res.ToUpdate = upd.ToUpdate
+	}
+
+	res.Attributes = make(map[string]broadcast.Attributes, len(res.ToUpdate))
+	for _, address := range res.ToUpdate {
+		res.Attributes[address] = rec.Attrs
+	}
+
 	s.rec.Set(domain, rec)
 	s.log.Debugw("resolved",
 		zap.String("domain", domain),
@@ -0,0 +1,129 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/im-kulikov/docker-dns/internal/broadcast"
+	"github.com/im-kulikov/docker-dns/internal/cacher"
+	"github.com/im-kulikov/go-bones/logger"
+	"github.com/miekg/dns"
+)
+
+// newTestUpstream starts DNS server, that answers A queries of the records.
+// AAAA queries are dropped when drop is set, so they fail by timeout.
+func newTestUpstream(t *testing.T, records map[string]string, drop bool) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		query := req.Question[0]
+		if query.Qtype == dns.TypeAAAA && drop {
+			return
+		}
+
+		res := new(dns.Msg)
+		res.SetReply(req)
+
+		if address, ok := records[query.Name]; ok && query.Qtype == dns.TypeA {
+			res.Answer = append(res.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: query.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+				A:   net.ParseIP(address),
+			})
+		}
+
+		_ = w.WriteMsg(res)
+	})}
+
+	go func() { _ = srv.ActivateAndServe() }()
+
+	t.Cleanup(func() { _ = srv.Shutdown() })
+
+	return conn.LocalAddr().String()
+}
+
+func TestFetchDomainsPartialFailure(t *testing.T) {
+	upstream := newTestUpstream(t, map[string]string{"example.test.": "192.0.2.1"}, true)
+
+	cfg := Config{Servers: []string{upstream}, Domains: []string{"example.test"}}
+	svc, err := New(cfg, logger.ForTests(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	res := svc.(*server).fetchDomains(context.Background(), time.Minute)
+
+	// AAAA query fails by client timeout, A answers are kept
+	if spent := time.Since(now); spent > time.Second*10 {
+		t.Fatalf("expected result before fetch timeout, spent %s", spent)
+	}
+
+	if len(res.msg.ToUpdate) != 1 || res.msg.ToUpdate[0] != "192.0.2.1" {
+		t.Fatalf("expected A address to be announced, got %v", res.msg.ToUpdate)
+	}
+}
+
+func TestFetchDomainsAttributesChanged(t *testing.T) {
+	upstream := newTestUpstream(t, map[string]string{"example.test.": "192.0.2.1"}, false)
+
+	cfg := Config{Servers: []string{upstream}, Domains: []string{"example.test;med=10"}}
+	svc, err := New(cfg, logger.ForTests(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := svc.(*server)
+	if res := srv.fetchDomains(context.Background(), time.Minute); len(res.msg.ToUpdate) != 1 {
+		t.Fatalf("expected address to be announced, got %v", res.msg.ToUpdate)
+	}
+
+	// records are cached, so only attributes are announced again
+	med := uint32(20)
+	item := cacher.NewItem("example.test")
+	item.Attrs = broadcast.Attributes{MED: &med}
+	if !svc.Set("example.test", item) {
+		t.Fatal("could not set attributes")
+	}
+
+	res := srv.fetchDomains(context.Background(), time.Minute)
+	if len(res.msg.ToUpdate) != 1 || res.msg.ToUpdate[0] != "192.0.2.1" {
+		t.Fatalf("expected cached address to be announced again, got %v", res.msg.ToUpdate)
+	}
+
+	if attrs := res.msg.Attributes["192.0.2.1"]; attrs.MED == nil || *attrs.MED != med {
+		t.Fatalf("expected new attributes, got %+v", attrs)
+	}
+
+	if res = srv.fetchDomains(context.Background(), time.Minute); len(res.msg.ToUpdate) != 0 {
+		t.Fatalf("expected nothing to announce, got %v", res.msg.ToUpdate)
+	}
+}
+
+func TestFetchDomainsSharedAddress(t *testing.T) {
+	upstream := newTestUpstream(t, map[string]string{
+		"a.test.": "192.0.2.1",
+		"b.test.": "192.0.2.1",
+		"c.test.": "192.0.2.1",
+	}, false)
+
+	// address of several domains gets attributes of the first one
+	for i := 0; i < 10; i++ {
+		cfg := Config{Servers: []string{upstream}, Domains: []string{"c.test;med=30", "b.test;med=20", "a.test;med=10"}}
+		svc, err := New(cfg, logger.ForTests(t), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := svc.(*server).fetchDomains(context.Background(), time.Minute)
+		if attrs := res.msg.Attributes["192.0.2.1"]; attrs.MED == nil || *attrs.MED != 10 {
+			t.Fatalf("expected attributes of a.test, got %+v", attrs)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package dns
 
-import "github.com/im-kulikov/docker-dns/internal/cacher"
+import (
+	"github.com/im-kulikov/docker-dns/internal/broadcast"
+	"github.com/im-kulikov/docker-dns/internal/cacher"
+)
 
 func (s *server) findDomain(domain string) (int, bool) {
 	s.RLock()
@@ -24,25 +27,74 @@ func (s *server) Get(domain string) (*cacher.CacheItem, bool) {
 }
 
 func (s *server) Set(domain string, item *cacher.CacheItem) bool {
-	if !s.rec.Set(domain, item) {
+	// cached records are kept, so they're announced again with new attributes
+	if _, ok := s.rec.Get(domain); !ok && !s.rec.Set(domain, item) {
 		return false
 	}
 
-	if id, ok := s.findDomain(domain); ok {
+	id, ok := s.findDomain(domain)
+
+	s.Lock()
+	defer s.Unlock()
+
+	if ok {
 		s.cfg.Domains[id] = item.Domain
 	} else {
 		s.cfg.Domains = append(s.cfg.Domains, item.Domain)
 	}
 
+	s.att[item.Domain] = item.Attrs
+
 	return true
 }
 
+// attributes returns BGP attributes of the domain.
+func (s *server) attributes(domain string) broadcast.Attributes {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.att[domain]
+}
+
+// owners returns domain of every resolved address. Address could be resolved
+// for several domains, then it's announced with attributes of the first domain
+// in lexical order, so the result doesn't depend on order of answers.
+func (s *server) owners() map[string]string {
+	s.RLock()
+	defer s.RUnlock()
+
+	out := make(map[string]string)
+	for _, domain := range s.cfg.Domains {
+		rec, ok := s.rec.Get(domain)
+		if !ok {
+			continue
+		}
+
+		rec.RLock()
+		for _, address := range rec.Record {
+			if cur, ok := out[address]; !ok || domain < cur {
+				out[address] = domain
+			}
+		}
+		rec.RUnlock()
+	}
+
+	return out
+}
+
 func (s *server) Delete(domain string) {
 	s.rec.Delete(domain)
 
-	if id, ok := s.findDomain(domain); ok {
+	id, ok := s.findDomain(domain)
+
+	s.Lock()
+	defer s.Unlock()
+
+	if ok {
 		s.cfg.Domains = append(s.cfg.Domains[:id], s.cfg.Domains[id+1:]...)
 	}
+
+	delete(s.att, domain)
 }
 
 func (s *server) Range(iter cacher.Iter) { s.rec.Range(iter) }
@@ -54,7 +106,7 @@ func (s *server) List() map[string]*cacher.CacheItem {
 		if item, ok := s.rec.Get(domain); ok {
 			out[domain] = item
 		} else {
-			out[domain] = &cacher.CacheItem{Domain: domain}
+			out[domain] = &cacher.CacheItem{Domain: domain, Attrs: s.att[domain]}
 		}
 	}
 	s.RUnlock()
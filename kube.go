@@ -0,0 +1,495 @@
+package dns
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/im-kulikov/go-bones/logger"
+	"github.com/im-kulikov/go-bones/service"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+const (
+	kubeServicesPath = "/api/v1/services"
+	kubeSlicesPath   = "/apis/discovery.k8s.io/v1/endpointslices"
+
+	// labelKubeService links EndpointSlice with its Service.
+	labelKubeService = "kubernetes.io/service-name"
+
+	kubeRetryDelay   = time.Second * 5
+	kubeWatchTimeout = 300 // seconds
+)
+
+// errKubeGone means that resource version is too old and resources should be listed again.
+var errKubeGone = errors.New("resource version expired")
+
+type kubeMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace"`
+	ResourceVersion string            `json:"resourceVersion"`
+	Labels          map[string]string `json:"labels"`
+}
+
+type kubePort struct {
+	Name     string `json:"name"`
+	Port     int32  `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+type kubeService struct {
+	Metadata kubeMeta `json:"metadata"`
+	Spec     struct {
+		ClusterIP  string     `json:"clusterIP"`
+		ClusterIPs []string   `json:"clusterIPs"`
+		Ports      []kubePort `json:"ports"`
+	} `json:"spec"`
+}
+
+type kubeSlice struct {
+	Metadata  kubeMeta `json:"metadata"`
+	Endpoints []struct {
+		Addresses  []string `json:"addresses"`
+		Conditions struct {
+			Ready *bool `json:"ready"`
+		} `json:"conditions"`
+	} `json:"endpoints"`
+}
+
+type kubeList[T any] struct {
+	Metadata kubeMeta `json:"metadata"`
+	Items    []T      `json:"items"`
+}
+
+type kubeWatchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// kubeObject is used to read resource version of watched object.
+type kubeObject struct {
+	Metadata kubeMeta `json:"metadata"`
+}
+
+// kubeStatus is an object of ERROR watch event.
+type kubeStatus struct {
+	Code int `json:"code"`
+}
+
+type kubeEvent struct {
+	path  string
+	event kubeWatchEvent
+}
+
+// kubeCache publishes Kubernetes services as `<service>.<namespace>.<zone>`
+// A records and `_<port>._<proto>.<service>.<namespace>.<zone>` SRV records.
+// Headless services resolve to ready endpoints.
+type kubeCache struct {
+	service.Service
+
+	cfg KubeConfig
+	cli *http.Client
+	log logger.Logger
+	uri *url.URL
+
+	// svc and slc are accessed from Run loop only
+	svc map[string]kubeService
+	slc map[string]kubeSlice
+
+	*recordStore
+}
+
+// NewKubeCache creates records source for Kubernetes services, it should be
+// passed to Server.SetCache.
+func NewKubeCache(cfg KubeConfig, log logger.Logger) (CacheWorker, error) {
+	uri, err := url.Parse(cfg.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	var cli *http.Client
+	if cli, err = cfg.prepareClient(); err != nil {
+		return nil, fmt.Errorf("could not prepare Kubernetes client: %w", err)
+	}
+
+	svc := kubeCache{
+		cfg: cfg,
+		cli: cli,
+		uri: uri,
+		log: log,
+
+		svc: make(map[string]kubeService),
+		slc: make(map[string]kubeSlice),
+
+		recordStore: newRecordStore(log),
+	}
+
+	svc.Service = service.NewWorker("kube-dns-cache", svc.Run)
+
+	return &svc, nil
+}
+
+func kubeKey(meta kubeMeta) string { return meta.Namespace + "/" + meta.Name }
+
+func (k *kubeCache) request(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	uri := k.uri.JoinPath(path)
+	uri.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// token is re-read, because service account tokens are rotated
+	var token string
+	if token, err = k.cfg.token(); err != nil {
+		return nil, err
+	} else if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	var res *http.Response
+	if res, err = k.cli.Do(req); err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		defer closeIt(k.log, res.Body)
+
+		out, _ := io.ReadAll(res.Body)
+		if res.StatusCode == http.StatusGone {
+			return nil, fmt.Errorf("%s: %w", path, errKubeGone)
+		}
+
+		return nil, fmt.Errorf("HTTP Error: %d\n%s", res.StatusCode, string(out))
+	}
+
+	return res, nil
+}
+
+func kubeFetch[T any](ctx context.Context, k *kubeCache, path string) (*kubeList[T], error) {
+	ctx, cancel := context.WithTimeout(ctx, k.cfg.Timeout)
+	defer cancel()
+
+	res, err := k.request(ctx, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer closeIt(k.log, res.Body)
+
+	var out kubeList[T]
+	if err = json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+func (k *kubeCache) zone() string { return strings.Trim(k.cfg.Zone, ".") }
+
+// serviceRecords builds records of the service and its endpoints.
+func (k *kubeCache) serviceRecords(svc kubeService) []dns.RR {
+	name := dns.Fqdn(svc.Metadata.Name + "." + svc.Metadata.Namespace + "." + k.zone())
+
+	addresses := svc.Spec.ClusterIPs
+	if len(addresses) == 0 && svc.Spec.ClusterIP != "" {
+		addresses = []string{svc.Spec.ClusterIP}
+	}
+
+	// headless services resolve to the ready endpoints
+	if len(addresses) == 0 || addresses[0] == "None" {
+		addresses = k.readyEndpoints(svc.Metadata)
+	}
+
+	var out []dns.RR
+	for _, address := range addresses {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			continue
+		}
+
+		hdr := dns.RR_Header{Name: name, Class: dns.ClassINET, Ttl: 30}
+		if ip4 := ip.To4(); ip4 != nil {
+			hdr.Rrtype = dns.TypeA
+			out = append(out, &dns.A{Hdr: hdr, A: ip4})
+
+			continue
+		}
+
+		hdr.Rrtype = dns.TypeAAAA
+		out = append(out, &dns.AAAA{Hdr: hdr, AAAA: ip})
+	}
+
+	for _, port := range svc.Spec.Ports {
+		// the same way as cluster DNS does, only named ports are published
+		if port.Name == "" {
+			continue
+		}
+
+		out = append(out, &dns.SRV{
+			Hdr: dns.RR_Header{
+				Name:   "_" + port.Name + "._" + strings.ToLower(port.Protocol) + "." + name,
+				Rrtype: dns.TypeSRV,
+				Class:  dns.ClassINET,
+				Ttl:    30,
+			},
+			Priority: 0,
+			Weight:   100,
+			Port:     uint16(port.Port),
+			Target:   name,
+		})
+	}
+
+	return out
+}
+
+func (k *kubeCache) readyEndpoints(meta kubeMeta) []string {
+	var out []string
+	for _, slice := range k.slc {
+		if slice.Metadata.Namespace != meta.Namespace || slice.Metadata.Labels[labelKubeService] != meta.Name {
+			continue
+		}
+
+		for _, endpoint := range slice.Endpoints {
+			// nil means ready, see EndpointConditions
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				continue
+			}
+
+			out = append(out, endpoint.Addresses...)
+		}
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+func (k *kubeCache) refreshService(key string) {
+	svc, ok := k.svc[key]
+	if !ok {
+		k.remove(key)
+
+		return
+	}
+
+	records := k.serviceRecords(svc)
+	k.replace(key, groupRecords(records))
+
+	k.log.Debugw("kubernetes service refreshed",
+		zap.String("service", key),
+		zap.Int("records", len(records)))
+}
+
+func (k *kubeCache) resync(ctx context.Context) (string, string, error) {
+	services, err := kubeFetch[kubeService](ctx, k, kubeServicesPath)
+	if err != nil {
+		return "", "", fmt.Errorf("could not list services: %w", err)
+	}
+
+	slices, err := kubeFetch[kubeSlice](ctx, k, kubeSlicesPath)
+	if err != nil {
+		return "", "", fmt.Errorf("could not list endpoint slices: %w", err)
+	}
+
+	k.svc = make(map[string]kubeService, len(services.Items))
+	for _, item := range services.Items {
+		k.svc[kubeKey(item.Metadata)] = item
+	}
+
+	k.slc = make(map[string]kubeSlice, len(slices.Items))
+	for _, item := range slices.Items {
+		k.slc[kubeKey(item.Metadata)] = item
+	}
+
+	for key := range k.svc {
+		k.refreshService(key)
+	}
+
+	for _, key := range k.owners() {
+		if _, ok := k.svc[key]; !ok {
+			k.remove(key)
+		}
+	}
+
+	k.log.Infow("kubernetes services synchronized",
+		zap.Int("services", len(services.Items)),
+		zap.Int("slices", len(slices.Items)))
+
+	return services.Metadata.ResourceVersion, slices.Metadata.ResourceVersion, nil
+}
+
+// watch streams watch events of the resource. API server closes the stream
+// after timeoutSeconds, then watch is restarted from the last resource version.
+func (k *kubeCache) watch(ctx context.Context, path, version string, out chan<- kubeEvent) error {
+	for {
+		next, err := k.watchOnce(ctx, path, version, out)
+		if err != nil {
+			return err
+		}
+
+		k.log.Debugw("kubernetes watch closed, restart",
+			zap.String("path", path),
+			zap.String("version", next))
+
+		version = next
+	}
+}
+
+// watchOnce streams events until stream is closed, it returns resource
+// version of the last received object.
+func (k *kubeCache) watchOnce(ctx context.Context, path, version string, out chan<- kubeEvent) (string, error) {
+	res, err := k.request(ctx, path, url.Values{
+		"watch":               {"1"},
+		"resourceVersion":     {version},
+		"timeoutSeconds":      {strconv.Itoa(kubeWatchTimeout)},
+		"allowWatchBookmarks": {"true"},
+	})
+	if err != nil {
+		return version, err
+	}
+
+	defer closeIt(k.log, res.Body)
+
+	dec := json.NewDecoder(bufio.NewReader(res.Body))
+	for {
+		var event kubeWatchEvent
+		if err = dec.Decode(&event); errors.Is(err, io.EOF) {
+			return version, nil
+		} else if err != nil {
+			return version, err
+		}
+
+		var obj kubeObject
+		if event.Type != "ERROR" && json.Unmarshal(event.Object, &obj) == nil && obj.Metadata.ResourceVersion != "" {
+			version = obj.Metadata.ResourceVersion
+		}
+
+		// bookmarks only move resource version forward
+		if event.Type == "BOOKMARK" {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return version, ctx.Err()
+		case out <- kubeEvent{path: path, event: event}:
+		}
+	}
+}
+
+func (k *kubeCache) apply(item kubeEvent) error {
+	switch item.event.Type {
+	case "ERROR":
+		// usually 410 Gone, that means resource version is too old
+		var status kubeStatus
+		if err := json.Unmarshal(item.event.Object, &status); err == nil && status.Code == http.StatusGone {
+			return fmt.Errorf("watch %s: %w", item.path, errKubeGone)
+		}
+
+		return fmt.Errorf("watch %s: %s", item.path, string(item.event.Object))
+	case "ADDED", "MODIFIED", "DELETED":
+	default:
+		return nil
+	}
+
+	deleted := item.event.Type == "DELETED"
+
+	switch item.path {
+	case kubeServicesPath:
+		var svc kubeService
+		if err := json.Unmarshal(item.event.Object, &svc); err != nil {
+			return err
+		}
+
+		key := kubeKey(svc.Metadata)
+		if deleted {
+			delete(k.svc, key)
+		} else {
+			k.svc[key] = svc
+		}
+
+		k.refreshService(key)
+	case kubeSlicesPath:
+		var slice kubeSlice
+		if err := json.Unmarshal(item.event.Object, &slice); err != nil {
+			return err
+		}
+
+		if deleted {
+			delete(k.slc, kubeKey(slice.Metadata))
+		} else {
+			k.slc[kubeKey(slice.Metadata)] = slice
+		}
+
+		k.refreshService(slice.Metadata.Namespace + "/" + slice.Metadata.Labels[labelKubeService])
+	}
+
+	return nil
+}
+
+func (k *kubeCache) sync(ctx context.Context) error {
+	svcVersion, slcVersion, err := k.resync(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	out := make(chan kubeEvent)
+	errs := make(chan error, 2)
+
+	go func() { errs <- k.watch(ctx, kubeServicesPath, svcVersion, out) }()
+	go func() { errs <- k.watch(ctx, kubeSlicesPath, slcVersion, out) }()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err = <-errs:
+			return err
+		case item := <-out:
+			if err = k.apply(item); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (k *kubeCache) Run(ctx context.Context) error {
+	for {
+		err := k.sync(ctx)
+		switch {
+		case errors.Is(err, errKubeGone) && ctx.Err() == nil:
+			// expected, when watch was not restarted for a long time
+			k.log.Infow("kubernetes resource version expired, relist", zap.Error(err))
+
+			continue
+		case err != nil:
+			k.log.Warnw("kubernetes watch interrupted, resync",
+				zap.Stringer("delay", kubeRetryDelay),
+				zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(kubeRetryDelay):
+		}
+	}
+}
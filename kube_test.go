@@ -0,0 +1,185 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/im-kulikov/go-bones/logger"
+	"github.com/miekg/dns"
+)
+
+func kubeServiceJSON(name, version, ip string) string {
+	return fmt.Sprintf(`{"metadata":{"name":%q,"namespace":"default","resourceVersion":%q},`+
+		`"spec":{"clusterIP":%q,"ports":[{"name":"http","port":80,"protocol":"TCP"}]}}`, name, version, ip)
+}
+
+// fakeKubeAPI serves list and watch requests of services, watches of
+// endpoint slices are kept open until request is cancelled.
+type fakeKubeAPI struct {
+	sync.Mutex
+
+	lists   int
+	watches []string
+	proceed chan struct{}
+}
+
+func (f *fakeKubeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher := w.(http.Flusher)
+	watch := r.URL.Query().Get("watch") == "1"
+
+	if !watch {
+		switch r.URL.Path {
+		case kubeServicesPath:
+			f.Lock()
+			f.lists++
+			list := f.lists
+			f.Unlock()
+
+			if list == 1 {
+				_, _ = fmt.Fprintf(w, `{"metadata":{"resourceVersion":"1"},"items":[%s]}`,
+					kubeServiceJSON("web", "1", "10.96.0.10"))
+
+				return
+			}
+
+			_, _ = fmt.Fprintf(w, `{"metadata":{"resourceVersion":"10"},"items":[%s]}`,
+				kubeServiceJSON("db", "10", "10.96.0.20"))
+		default:
+			_, _ = fmt.Fprint(w, `{"metadata":{"resourceVersion":"1"},"items":[]}`)
+		}
+
+		return
+	}
+
+	if r.URL.Path != kubeServicesPath {
+		<-r.Context().Done()
+
+		return
+	}
+
+	f.Lock()
+	f.watches = append(f.watches, r.URL.Query().Get("resourceVersion"))
+	count := len(f.watches)
+	f.Unlock()
+
+	switch count {
+	case 1:
+		for _, event := range []string{
+			`{"type":"ADDED","object":` + kubeServiceJSON("api", "2", "10.96.0.11") + `}`,
+			`{"type":"MODIFIED","object":` + kubeServiceJSON("web", "3", "10.96.0.12") + `}`,
+			`{"type":"DELETED","object":` + kubeServiceJSON("api", "4", "10.96.0.11") + `}`,
+		} {
+			_, _ = fmt.Fprintln(w, event)
+			flusher.Flush()
+		}
+		// stream is closed, like after timeoutSeconds
+	case 2:
+		select {
+		case <-f.proceed:
+		case <-r.Context().Done():
+			return
+		}
+
+		_, _ = fmt.Fprintln(w, `{"type":"ERROR","object":{"kind":"Status","code":410,"reason":"Expired"}}`)
+		flusher.Flush()
+
+		<-r.Context().Done()
+	default:
+		<-r.Context().Done()
+	}
+}
+
+func (f *fakeKubeAPI) versions() []string {
+	f.Lock()
+	defer f.Unlock()
+
+	return append([]string(nil), f.watches...)
+}
+
+func kubeAddress(t *testing.T, k *kubeCache, name string) string {
+	t.Helper()
+
+	rec, err := k.Get(dns.Question{Name: name, Qtype: dns.TypeA, Qclass: dns.ClassINET})
+	if err != nil || len(rec) == 0 {
+		return ""
+	}
+
+	return rec[0].(*dns.A).A.String()
+}
+
+func eventually(t *testing.T, what string, fn func() bool) {
+	t.Helper()
+
+	// shorter than kubeRetryDelay, so relist must not be delayed
+	deadline := time.Now().Add(time.Second * 3)
+	for !fn() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestKubeCacheWatch(t *testing.T) {
+	api := &fakeKubeAPI{proceed: make(chan struct{})}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	cfg := KubeConfig{Enabled: true, Address: srv.URL, Zone: "k8s.lan", Timeout: time.Second}
+
+	worker, err := NewKubeCache(cfg, logger.ForTests(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := worker.(*kubeCache)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- k.Run(ctx) }()
+
+	defer func() {
+		cancel()
+
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// list, then ADDED / MODIFIED / DELETED events
+	eventually(t, "modified service", func() bool {
+		return kubeAddress(t, k, "web.default.k8s.lan.") == "10.96.0.12" &&
+			kubeAddress(t, k, "api.default.k8s.lan.") == "" &&
+			len(api.versions()) == 2
+	})
+
+	// normal close restarts watch from the last resource version
+	if versions := api.versions(); versions[0] != "1" || versions[1] != "4" {
+		t.Fatalf("unexpected watch versions %v", versions)
+	}
+
+	rec, err := k.Get(dns.Question{Name: "_http._tcp.web.default.k8s.lan.", Qtype: dns.TypeSRV, Qclass: dns.ClassINET})
+	if err != nil || len(rec) != 1 || rec[0].(*dns.SRV).Port != 80 {
+		t.Fatalf("unexpected SRV records %v (%v)", rec, err)
+	}
+
+	// 410 Gone relists resources immediately
+	close(api.proceed)
+
+	eventually(t, "relist", func() bool {
+		return kubeAddress(t, k, "db.default.k8s.lan.") == "10.96.0.20" &&
+			kubeAddress(t, k, "web.default.k8s.lan.") == ""
+	})
+
+	eventually(t, "watch from relisted version", func() bool {
+		versions := api.versions()
+
+		return len(versions) == 3 && versions[2] == "10"
+	})
+}
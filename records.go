@@ -0,0 +1,92 @@
+package dns
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	labelComposeProject = "com.docker.compose.project"
+
+	// maxTXTString is a limit of single character-string in TXT record.
+	maxTXTString = 255
+)
+
+// containerName returns FQDN of the container. When subdomain is set, it's
+// inserted after the first label: web.docker.lan → web.<subdomain>.docker.lan.
+func containerName(container *Container, subdomain string) string {
+	name := container.Hostname
+	if i := strings.IndexByte(name, '.'); subdomain != "" && i > 0 {
+		name = name[:i] + "." + subdomain + name[i:]
+	}
+
+	return dns.Fqdn(name)
+}
+
+// rotate returns records in round-robin order, shifted by n.
+func rotate(records []dns.RR, n uint32) []dns.RR {
+	if len(records) < 2 {
+		return records
+	}
+
+	shift := int(n % uint32(len(records)))
+
+	out := make([]dns.RR, 0, len(records))
+	out = append(out, records[shift:]...)
+
+	return append(out, records[:shift]...)
+}
+
+func txtString(key, val string) string {
+	out := key + "=" + val
+	if len(out) <= maxTXTString {
+		return out
+	}
+
+	// cut on rune boundary, to not split multi-byte character
+	n := maxTXTString
+	for n > 0 && !utf8.RuneStart(out[n]) {
+		n--
+	}
+
+	return out[:n]
+}
+
+// containerTXT returns TXT record that describes container metadata.
+// Only labels from allow-list are exposed, to not leak secrets.
+func containerTXT(name string, container *Container, labels []string) *dns.TXT {
+	txt := []string{
+		txtString("id", container.ID),
+		txtString("image", container.Image),
+	}
+
+	if project, ok := container.Labels[labelComposeProject]; ok {
+		txt = append(txt, txtString("project", project))
+	}
+
+	allowed := make([]string, 0, len(labels))
+	for _, label := range labels {
+		if _, ok := container.Labels[label]; ok {
+			allowed = append(allowed, label)
+		}
+	}
+
+	sort.Strings(allowed)
+
+	for _, label := range allowed {
+		txt = append(txt, txtString("label."+label, container.Labels[label]))
+	}
+
+	return &dns.TXT{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeTXT,
+			Class:  dns.ClassINET,
+			Ttl:    3600,
+		},
+		Txt: txt,
+	}
+}
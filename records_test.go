@@ -0,0 +1,38 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTxtString(t *testing.T) {
+	cases := []struct {
+		name string
+		key  string
+		val  string
+		want string
+	}{
+		{name: "short", key: "id", val: "abc", want: "id=abc"},
+		{name: "exact", key: "id", val: strings.Repeat("a", 252), want: "id=" + strings.Repeat("a", 252)},
+		{name: "ascii", key: "id", val: strings.Repeat("a", 300), want: "id=" + strings.Repeat("a", 252)},
+		// "id=" + 126 two-byte runes is 255 bytes, the next rune doesn't fit
+		{name: "runes", key: "id", val: strings.Repeat("ж", 200), want: "id=" + strings.Repeat("ж", 126)},
+		// odd prefix moves rune boundary, cut before the split character
+		{name: "split", key: "ab", val: strings.Repeat("ж", 200), want: "ab=" + strings.Repeat("ж", 126)},
+		{name: "shifted", key: "a", val: strings.Repeat("ж", 200), want: "a=" + strings.Repeat("ж", 126)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := txtString(tc.key, tc.val)
+			if got != tc.want {
+				t.Fatalf("expected %q (%d bytes), got %q (%d bytes)", tc.want, len(tc.want), got, len(got))
+			}
+
+			if len(got) > maxTXTString || !utf8.ValidString(got) {
+				t.Fatalf("invalid character-string %q", got)
+			}
+		})
+	}
+}
@@ -6,17 +6,61 @@ import (
 	"github.com/miekg/dns"
 )
 
+// layeredCacher separates exact lookups from wildcard ones, so an exact name
+// known by any store takes priority over a wildcard of another store.
+type layeredCacher interface {
+	exact(dns.Question) ([]dns.RR, error)
+	wildcard(dns.Question) ([]dns.RR, error)
+}
+
+func exactGet(store Cacher, query dns.Question) ([]dns.RR, error) {
+	if layered, ok := store.(layeredCacher); ok {
+		return layered.exact(query)
+	}
+
+	return store.Get(query)
+}
+
+func wildcardGet(store Cacher, query dns.Question) ([]dns.RR, error) {
+	if layered, ok := store.(layeredCacher); ok {
+		return layered.wildcard(query)
+	}
+
+	return nil, ErrNotFound
+}
+
 type chainStore struct {
 	stores []Cacher
 }
 
-var _ Cacher = (*chainStore)(nil)
+var (
+	_ Cacher        = (*chainStore)(nil)
+	_ layeredCacher = (*chainStore)(nil)
+)
 
+// Get looks for exact name in every store first, then for wildcards.
 func (c *chainStore) Get(query dns.Question) ([]dns.RR, error) {
+	if msg, err := c.exact(query); !errors.Is(err, ErrNotFound) {
+		return msg, err
+	}
+
+	return c.wildcard(query)
+}
+
+func (c *chainStore) exact(query dns.Question) ([]dns.RR, error) {
+	return c.first(query, exactGet)
+}
+
+func (c *chainStore) wildcard(query dns.Question) ([]dns.RR, error) {
+	return c.first(query, wildcardGet)
+}
+
+func (c *chainStore) first(query dns.Question, get func(Cacher, dns.Question) ([]dns.RR, error)) ([]dns.RR, error) {
+	// empty answers are treated as missing records, like in chase
 	for _, store := range c.stores {
-		if msg, err := store.Get(query); err == nil {
+		if msg, err := get(store, query); err == nil && len(msg) > 0 {
 			return msg, nil
-		} else if !errors.Is(err, ErrNotFound) {
+		} else if err != nil && !errors.Is(err, ErrNotFound) {
 			return nil, err
 		}
 	}
@@ -29,3 +73,64 @@ func (c *chainStore) Set(query dns.Question, cid string, msg []dns.RR) {
 		store.Set(query, cid, msg)
 	}
 }
+
+// mergeStore merges answers of every store,
+// it's used to aggregate records of several Docker hosts.
+type mergeStore struct {
+	stores []Cacher
+}
+
+var (
+	_ Cacher        = (*mergeStore)(nil)
+	_ layeredCacher = (*mergeStore)(nil)
+)
+
+// Get merges exact names of every store, wildcards are used only when
+// no store knows the exact name.
+func (m *mergeStore) Get(query dns.Question) ([]dns.RR, error) {
+	if msg, err := m.exact(query); !errors.Is(err, ErrNotFound) {
+		return msg, err
+	}
+
+	return m.wildcard(query)
+}
+
+func (m *mergeStore) exact(query dns.Question) ([]dns.RR, error) {
+	return m.merge(query, exactGet)
+}
+
+func (m *mergeStore) wildcard(query dns.Question) ([]dns.RR, error) {
+	return m.merge(query, wildcardGet)
+}
+
+func (m *mergeStore) merge(query dns.Question, get func(Cacher, dns.Question) ([]dns.RR, error)) ([]dns.RR, error) {
+	var (
+		out  []dns.RR
+		errs []error
+	)
+
+	for _, store := range m.stores {
+		msg, err := get(store, query)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		out = append(out, msg...)
+	}
+
+	if len(out) > 0 {
+		return dns.Dedup(out, nil), nil
+	} else if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return nil, ErrNotFound
+}
+
+func (m *mergeStore) Set(query dns.Question, cid string, msg []dns.RR) {
+	for _, store := range m.stores {
+		store.Set(query, cid, msg)
+	}
+}
@@ -0,0 +1,80 @@
+package dns
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/im-kulikov/go-bones/logger"
+	"github.com/miekg/dns"
+)
+
+// exactStore knows exact names only, like dockerStore.
+type exactStore map[dns.Question][]dns.RR
+
+func (e exactStore) Get(query dns.Question) ([]dns.RR, error) {
+	if rec, ok := e[query]; ok {
+		return rec, nil
+	}
+
+	return nil, ErrNotFound
+}
+
+func (exactStore) Set(dns.Question, string, []dns.RR) {}
+
+func testA(name, addr string) *dns.A {
+	return &dns.A{
+		Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 3600},
+		A:   net.ParseIP(addr),
+	}
+}
+
+func testQuestion(name string, qtype uint16) dns.Question {
+	return dns.Question{Name: name, Qtype: qtype, Qclass: dns.ClassINET}
+}
+
+func TestChainStoreWildcard(t *testing.T) {
+	cache := newRecordStore(logger.ForTests(t))
+	cache.Set(testQuestion("*.app.lan.", dns.TypeA), "wildcard", []dns.RR{testA("*.app.lan.", "10.0.0.1")})
+	cache.Set(testQuestion("*.lan.", dns.TypeA), "farther", []dns.RR{testA("*.lan.", "10.0.0.3")})
+
+	docker := exactStore{
+		testQuestion("api.app.lan.", dns.TypeA): {testA("api.app.lan.", "10.0.0.2")},
+	}
+
+	cases := []struct {
+		name  string
+		store Cacher
+		query string
+		want  string
+	}{
+		{name: "exact in another store", store: &chainStore{stores: []Cacher{cache, docker}}, query: "api.app.lan.", want: "10.0.0.2"},
+		{name: "closest wildcard", store: &chainStore{stores: []Cacher{cache, docker}}, query: "web.app.lan.", want: "10.0.0.1"},
+		{name: "deep wildcard", store: &chainStore{stores: []Cacher{cache, docker}}, query: "a.b.app.lan.", want: "10.0.0.1"},
+		{name: "farther wildcard", store: &chainStore{stores: []Cacher{cache, docker}}, query: "db.lan.", want: "10.0.0.3"},
+		{name: "merged hosts", store: &mergeStore{stores: []Cacher{&chainStore{stores: []Cacher{cache}}, docker}}, query: "api.app.lan.", want: "10.0.0.2"},
+		{name: "missing", store: &chainStore{stores: []Cacher{docker}}, query: "web.app.lan."},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec, err := tc.store.Get(testQuestion(tc.query, dns.TypeA))
+			if tc.want == "" {
+				if !errors.Is(err, ErrNotFound) {
+					t.Fatalf("expected ErrNotFound, got %v (%v)", err, rec)
+				}
+
+				return
+			}
+
+			if err != nil || len(rec) != 1 {
+				t.Fatalf("expected single record, got %v (%v)", rec, err)
+			}
+
+			a, ok := rec[0].(*dns.A)
+			if !ok || a.A.String() != tc.want || a.Hdr.Name != tc.query {
+				t.Fatalf("expected %s %s, got %v", tc.query, tc.want, rec[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/im-kulikov/go-bones/logger"
+	"github.com/im-kulikov/go-bones/service"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+type routerSync struct {
+	service.Service
+
+	cfg RouterConfig
+	cli *client
+	log logger.Logger
+	src []watchable
+
+	// dty notifies that records were changed
+	dty chan struct{}
+}
+
+// NewRouterSync creates worker, that keeps RouterOS static DNS entries
+// (A, AAAA and CNAME) in sync with container records.
+func NewRouterSync(cfg RouterConfig, log logger.Logger, hosts ...*Host) (service.Service, error) {
+	cli, err := cfg.prepareClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not prepare RouterOS client: %w", err)
+	}
+
+	cli.setLogger(log)
+
+	svc := routerSync{
+		cfg: cfg,
+		cli: cli,
+		log: log,
+		src: hostSources(hosts),
+		dty: make(chan struct{}, 1),
+	}
+
+	for _, src := range svc.src {
+		src.subscribe(svc.changed)
+	}
+
+	svc.Service = service.NewWorker("routeros-static-dns", svc.Run)
+
+	return &svc, nil
+}
+
+func (r *routerSync) changed() {
+	select {
+	case r.dty <- struct{}{}:
+	default:
+	}
+}
+
+// staticType returns type of the entry, RouterOS leaves it empty for A entries.
+func staticType(rec StaticDNSRecord) string {
+	if rec.Type == "" {
+		return "A"
+	}
+
+	return rec.Type
+}
+
+// staticGroup returns name and type of the entry, entries of the group
+// could be updated in place.
+func staticGroup(rec StaticDNSRecord) string { return rec.Name + "/" + staticType(rec) }
+
+func staticKey(rec StaticDNSRecord) string {
+	value := rec.Address
+	if staticType(rec) == "CNAME" {
+		value = rec.CNAME
+	}
+
+	return staticGroup(rec) + "/" + value
+}
+
+// desired returns static DNS entries of container records.
+func (r *routerSync) desired() map[string]StaticDNSRecord {
+	out := make(map[string]StaticDNSRecord)
+	for _, rr := range dumpSources(r.src) {
+		hdr := rr.Header()
+
+		// RouterOS static names don't support wildcards
+		if strings.HasPrefix(hdr.Name, "*.") {
+			continue
+		}
+
+		rec := StaticDNSRecord{
+			Name:    strings.TrimSuffix(hdr.Name, "."),
+			TTL:     strconv.FormatUint(uint64(hdr.Ttl), 10),
+			Comment: r.cfg.Tag,
+		}
+
+		switch v := rr.(type) {
+		case *dns.A:
+			rec.Type, rec.Address = "A", v.A.String()
+		case *dns.AAAA:
+			rec.Type, rec.Address = "AAAA", v.AAAA.String()
+		case *dns.CNAME:
+			rec.Type, rec.CNAME = "CNAME", strings.TrimSuffix(v.Target, ".")
+		default:
+			continue
+		}
+
+		out[staticKey(rec)] = rec
+	}
+
+	return out
+}
+
+// routerRequest runs single RouterOS request with its own timeout,
+// so a long reconcile is not cancelled halfway.
+func routerRequest(top context.Context, timeout time.Duration, fn func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(top, timeout)
+	defer cancel()
+
+	return fn(ctx)
+}
+
+// reconcile creates missing, updates changed and removes stale entries,
+// that are owned by docker-dns.
+func (r *routerSync) reconcile(ctx context.Context) error {
+	var owned []StaticDNSRecord
+	err := routerRequest(ctx, r.cfg.Timeout, func(ctx context.Context) (err error) {
+		owned, err = r.cli.List(ctx, r.cfg.Tag)
+
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not fetch RouterOS static DNS: %w", err)
+	}
+
+	desired := r.desired()
+
+	// stale entries grouped by name and type, so they could be reused
+	stale := make(map[string][]StaticDNSRecord)
+	for _, item := range owned {
+		if _, ok := desired[staticKey(item)]; ok {
+			delete(desired, staticKey(item))
+
+			continue
+		}
+
+		stale[staticGroup(item)] = append(stale[staticGroup(item)], item)
+	}
+
+	var added, updated int
+	for _, rec := range desired {
+		group := staticGroup(rec)
+		if list := stale[group]; len(list) > 0 {
+			if err = routerRequest(ctx, r.cfg.Timeout, func(ctx context.Context) error {
+				return r.cli.Set(ctx, list[0].ID, rec)
+			}); err != nil {
+				return fmt.Errorf("could not update RouterOS static DNS %s: %w", rec.Name, err)
+			}
+
+			stale[group] = list[1:]
+			updated++
+
+			continue
+		}
+
+		if err = routerRequest(ctx, r.cfg.Timeout, func(ctx context.Context) error {
+			return r.cli.Add(ctx, rec)
+		}); err != nil {
+			return fmt.Errorf("could not create RouterOS static DNS %s: %w", rec.Name, err)
+		}
+
+		added++
+	}
+
+	var ids []string
+	for _, list := range stale {
+		for _, item := range list {
+			ids = append(ids, item.ID)
+		}
+	}
+
+	if len(ids) > 0 {
+		if err = routerRequest(ctx, r.cfg.Timeout, func(ctx context.Context) error {
+			return r.cli.Remove(ctx, ids...)
+		}); err != nil {
+			return fmt.Errorf("could not remove RouterOS static DNS: %w", err)
+		}
+	}
+
+	if added+updated+len(ids) > 0 {
+		r.log.Infow("RouterOS static DNS reconciled",
+			zap.Int("added", added),
+			zap.Int("updated", updated),
+			zap.Int("removed", len(ids)))
+	}
+
+	return nil
+}
+
+func (r *routerSync) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.reconcile(ctx); err != nil {
+			r.log.Warnw("could not reconcile RouterOS static DNS", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-r.dty:
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package dns
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStaticKey(t *testing.T) {
+	cases := []struct {
+		name string
+		rec  StaticDNSRecord
+		want string
+	}{
+		{name: "a", rec: StaticDNSRecord{Name: "web.lan", Type: "A", Address: "10.0.0.1"}, want: "web.lan/A/10.0.0.1"},
+		{name: "printed a", rec: StaticDNSRecord{Name: "web.lan", Address: "10.0.0.1"}, want: "web.lan/A/10.0.0.1"},
+		{name: "aaaa", rec: StaticDNSRecord{Name: "web.lan", Type: "AAAA", Address: "fd00::1"}, want: "web.lan/AAAA/fd00::1"},
+		{name: "cname", rec: StaticDNSRecord{Name: "www.lan", Type: "CNAME", CNAME: "web.lan"}, want: "www.lan/CNAME/web.lan"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := staticKey(tc.rec); got != tc.want {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRouterRequestTimeout(t *testing.T) {
+	slow := func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Millisecond * 30):
+			return nil
+		}
+	}
+
+	// every request fits into timeout, while all of them don't
+	for i := 0; i < 3; i++ {
+		if err := routerRequest(context.Background(), time.Millisecond*50, slow); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+
+	if err := routerRequest(context.Background(), time.Millisecond*10, slow); err == nil {
+		t.Fatal("expected slow request to time out")
+	}
+}
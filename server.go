@@ -2,9 +2,10 @@ package dns
 
 import (
 	"context"
+	"errors"
+	"net"
 	"sync"
 
-	"github.com/fsouza/go-dockerclient"
 	"github.com/im-kulikov/go-bones/logger"
 	"github.com/im-kulikov/go-bones/service"
 	"github.com/miekg/dns"
@@ -18,6 +19,20 @@ type server struct {
 	server *dns.Server
 	client *dns.Client
 	logger logger.Logger
+
+	// upstream resolves external queries and targets of aliases
+	upstream string
+
+	// zone transfer settings, zone is nil when transfers are disabled
+	xfr  TransferConfig
+	acl  []*net.IPNet
+	zone *zone
+	ser  *zoneSerial
+	tcp  *dns.Server
+
+	// dty notifies that zone should be reloaded, stop cancels watchZone
+	dty  chan struct{}
+	stop context.CancelFunc
 }
 
 type Server interface {
@@ -26,37 +41,101 @@ type Server interface {
 	SetCache(Cacher)
 }
 
-func NewServer(cfg Config, cli *docker.Client, log logger.Logger) Server {
-	return &server{
-		logger: log,
-		stores: &dockerStore{
-			client: cli,
-			logger: log,
-		},
+// NewServer creates DNS server, that merges records of every Docker host.
+func NewServer(cfg Config, log logger.Logger, hosts ...*Host) Server {
+	stores := make([]Cacher, 0, len(hosts))
+	for _, host := range hosts {
+		stores = append(stores, host.store())
+	}
+
+	srv := &server{
+		logger:   log,
+		upstream: defaultUpstream,
+		stores:   &mergeStore{stores: stores},
 		server: &dns.Server{
-			Net:  cfg.Network,
-			Addr: cfg.Address,
+			Net:        cfg.Network,
+			Addr:       cfg.Address,
+			TsigSecret: cfg.Transfer.tsigSecrets(),
 		},
+
+		xfr: cfg.Transfer,
+		acl: cfg.Transfer.acl(),
+	}
+
+	if cfg.Transfer.Zone == "" {
+		return srv
+	}
+
+	sources := hostSources(hosts)
+
+	srv.dty = make(chan struct{}, 1)
+	srv.ser = newZoneSerial(cfg.SnapshotDir, cfg.Transfer.Zone)
+	srv.zone = newZone(cfg.Transfer.Zone, cfg.Transfer.PrimaryNS, srv.ser.load(),
+		func() []dns.RR { return dumpSources(sources) })
+
+	srv.zone.update()
+	if err := srv.ser.save(srv.zone.Serial()); err != nil {
+		log.Warnw("could not persist zone serial", zap.String("zone", srv.zone.name), zap.Error(err))
+	}
+
+	for _, src := range sources {
+		src.subscribe(srv.zoneChanged)
 	}
+
+	srv.stores = &chainStore{stores: []Cacher{srv.zone, srv.stores}}
+
+	// transfers are served over TCP
+	if cfg.Network != "tcp" {
+		srv.tcp = &dns.Server{
+			Net:        "tcp",
+			Addr:       cfg.Address,
+			TsigSecret: cfg.Transfer.tsigSecrets(),
+		}
+	}
+
+	return srv
 }
 
 func (s *server) Name() string { return "docker-dns" }
 
+// SetCache adds records source that takes priority over Docker hosts.
 func (s *server) SetCache(v Cacher) {
-	if store, ok := s.stores.(*dockerStore); ok {
-		store.cacher = v
-	}
-
 	s.stores = &chainStore{stores: []Cacher{v, s.stores}}
 }
 
-func (s *server) Start(_ context.Context) error {
+func (s *server) Start(ctx context.Context) error {
 	s.server.Handler = s
 
+	if s.zone != nil {
+		ctx, s.stop = context.WithCancel(ctx)
+
+		go s.watchZone(ctx)
+	}
+
+	if s.tcp != nil {
+		s.tcp.Handler = s
+
+		go func() {
+			if err := s.tcp.ListenAndServe(); err != nil && !errors.Is(err, net.ErrClosed) {
+				s.logger.Errorw("could not start tcp server", zap.Error(err))
+			}
+		}()
+	}
+
 	return s.server.ListenAndServe()
 }
 
 func (s *server) Stop(ctx context.Context) {
+	if s.stop != nil {
+		s.stop()
+	}
+
+	if s.tcp != nil {
+		if err := s.tcp.ShutdownContext(ctx); err != nil {
+			s.logger.Errorw("could not shutdown tcp server", zap.Error(err))
+		}
+	}
+
 	if err := s.server.ShutdownContext(ctx); err != nil {
 		s.logger.Errorw("could not shutdown server", zap.Error(err))
 	}
@@ -0,0 +1,209 @@
+package dns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/im-kulikov/go-bones/logger"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+// snapshot persists records of a single host to the file.
+type snapshot struct {
+	path string
+}
+
+type snapshotRecord struct {
+	Owner  string `json:"owner"`
+	Record string `json:"record"`
+}
+
+type snapshotFile struct {
+	Saved   time.Time        `json:"saved"`
+	Records []snapshotRecord `json:"records"`
+}
+
+const (
+	// staleTTL is used for records restored from snapshot,
+	// so clients re-query them soon after reconcile.
+	staleTTL = 30
+
+	maxConnectDelay = time.Second * 30
+)
+
+func newSnapshot(dir, host string) *snapshot {
+	if dir == "" {
+		return nil
+	}
+
+	return &snapshot{path: filepath.Join(dir, host+".json")}
+}
+
+func (s *snapshot) load() (*snapshotFile, error) {
+	buf, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var out snapshotFile
+	if err = json.Unmarshal(buf, &out); err != nil {
+		return nil, err
+	}
+
+	return &out, nil
+}
+
+// save writes snapshot atomically, through temporary file.
+func (s *snapshot) save(records map[string][]dns.RR) error {
+	out := snapshotFile{Saved: time.Now()}
+	for oid, list := range records {
+		for _, rr := range list {
+			out.Records = append(out.Records, snapshotRecord{Owner: oid, Record: rr.String()})
+		}
+	}
+
+	buf, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err = os.WriteFile(tmp, buf, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+// restore loads records from snapshot, they are marked as stale
+// until the cache is reconciled with container backend.
+func (c *cache) restore() error {
+	if c.snp == nil {
+		return nil
+	}
+
+	file, err := c.snp.load()
+	if err != nil || file == nil {
+		return err
+	}
+
+	owners := make(map[string][]dns.RR)
+	for _, item := range file.Records {
+		var rr dns.RR
+		if rr, err = dns.NewRR(item.Record); err != nil || rr == nil {
+			c.log.Warnw("ignoring invalid snapshot record",
+				zap.String("record", item.Record),
+				zap.Error(err))
+
+			continue
+		}
+
+		rr.Header().Ttl = staleTTL
+		owners[item.Owner] = append(owners[item.Owner], rr)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+
+	c.stl = make(map[string]time.Time, len(owners))
+	for oid, records := range owners {
+		c.replace(oid, groupRecords(records))
+		c.stl[oid] = expires
+	}
+
+	if len(owners) > 0 && c.ttl > 0 {
+		c.exp = time.AfterFunc(c.ttl, c.expire)
+	}
+
+	c.log.Infow("restored stale records from snapshot",
+		zap.String("snapshot", c.snp.path),
+		zap.Time("saved", file.Saved),
+		zap.Int("containers", len(owners)),
+		zap.Int("records", len(file.Records)))
+
+	return nil
+}
+
+// expire withdraws restored records, that were not reconciled in time,
+// because container backend is still unreachable.
+func (c *cache) expire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.stl) == 0 {
+		return
+	}
+
+	c.log.Warnw("withdraw stale records, container backend is unreachable",
+		zap.Stringer("stale", c.ttl),
+		zap.Int("containers", len(c.stl)))
+
+	now := time.Now()
+	for oid, expires := range c.stl {
+		if now.Before(expires) {
+			continue
+		}
+
+		c.remove(oid)
+		delete(c.stl, oid)
+	}
+}
+
+func (c *cache) persist() {
+	if c.snp == nil {
+		return
+	}
+
+	records := c.dump()
+
+	// stale records would live forever, if they were restored again
+	c.mu.Lock()
+	for oid := range c.stl {
+		delete(records, oid)
+	}
+	c.mu.Unlock()
+
+	if err := c.snp.save(records); err != nil {
+		c.log.Warnw("could not persist records snapshot",
+			zap.String("snapshot", c.snp.path),
+			zap.Error(err))
+	}
+}
+
+// waitFor calls fn with exponential backoff until it succeeds or context is done.
+func waitFor(ctx context.Context, log logger.Logger, what string, fn func() error) bool {
+	delay := time.Second
+	for {
+		err := fn()
+		if err == nil {
+			return true
+		}
+
+		log.Warnw("waiting for "+what,
+			zap.Stringer("delay", delay),
+			zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; delay > maxConnectDelay {
+			delay = maxConnectDelay
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package dns
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/im-kulikov/go-bones/logger"
+	"github.com/miekg/dns"
+)
+
+func TestSnapshotStaleExpire(t *testing.T) {
+	snp := newSnapshot(t.TempDir(), "local")
+	if err := snp.save(map[string][]dns.RR{"c1": {testA("web.lan.", "10.0.0.1")}}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &cache{
+		log:         logger.ForTests(t),
+		snp:         snp,
+		ttl:         time.Millisecond * 10,
+		recordStore: newRecordStore(logger.ForTests(t)),
+	}
+
+	if err := c.restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := c.Get(testQuestion("web.lan.", dns.TypeA))
+	if err != nil || len(rec) != 1 || rec[0].Header().Ttl != staleTTL {
+		t.Fatalf("expected stale record, got %v (%v)", rec, err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err = c.Get(testQuestion("web.lan.", dns.TypeA)); errors.Is(err, ErrNotFound) {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("stale record was not expired: %v", err)
+		}
+
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+func TestSnapshotSkipsStale(t *testing.T) {
+	snp := newSnapshot(t.TempDir(), "local")
+	if err := snp.save(map[string][]dns.RR{"c1": {testA("web.lan.", "10.0.0.1")}}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &cache{
+		log:         logger.ForTests(t),
+		snp:         snp,
+		ttl:         time.Minute,
+		recordStore: newRecordStore(logger.ForTests(t)),
+	}
+
+	if err := c.restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.exp.Stop()
+
+	c.replace("c2", groupRecords([]dns.RR{testA("api.lan.", "10.0.0.2")}))
+	c.persist()
+
+	file, err := snp.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(file.Records) != 1 || file.Records[0].Owner != "c2" {
+		t.Fatalf("expected only fresh records in snapshot, got %+v", file.Records)
+	}
+}
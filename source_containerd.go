@@ -0,0 +1,240 @@
+package dns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/im-kulikov/go-bones/logger"
+	"go.uber.org/zap"
+)
+
+// containerdSource implements ContainerSource for containerd/nerdctl.
+// Containers are discovered through CNI results cache, hostnames and names
+// are taken from nerdctl state directory. Events are synthesized by polling.
+//
+// Labels, image and health live in containerd metadata store, that is not
+// read, so containers are always published (HEALTHY_ONLY has no effect) and
+// label based features (wildcards, aliases, TXT labels) are not supported.
+type containerdSource struct {
+	results string
+	state   string
+	log     logger.Logger
+
+	sync.Mutex
+	known map[string]struct{}
+}
+
+// cniCacheEntry is a format of CNI results cache (libcni cniCacheV1).
+type cniCacheEntry struct {
+	Kind        string `json:"kind"`
+	ContainerID string `json:"containerId"`
+	NetworkName string `json:"networkName"`
+	Result      struct {
+		IPs []struct {
+			Address string `json:"address"`
+		} `json:"ips"`
+	} `json:"result"`
+}
+
+const (
+	defaultCNIResults      = "/var/lib/cni/results"
+	defaultNerdctlState    = "/var/lib/nerdctl"
+	containerdPollInterval = time.Second * 5
+)
+
+var _ ContainerSource = (*containerdSource)(nil)
+
+func newContainerdSource(results, state string, log logger.Logger) *containerdSource {
+	if results == "" {
+		results = defaultCNIResults
+	}
+
+	if state == "" {
+		state = defaultNerdctlState
+	}
+
+	return &containerdSource{
+		results: results,
+		state:   state,
+		log:     log,
+		known:   make(map[string]struct{}),
+	}
+}
+
+func (c *containerdSource) Ping(context.Context) error {
+	_, err := os.Stat(c.results)
+
+	return err
+}
+
+func (c *containerdSource) readResults() (map[string][]cniCacheEntry, error) {
+	files, err := os.ReadDir(c.results)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string][]cniCacheEntry)
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		var buf []byte
+		if buf, err = os.ReadFile(filepath.Join(c.results, file.Name())); err != nil {
+			// file could be removed while we read directory
+			continue
+		}
+
+		var entry cniCacheEntry
+		if err = json.Unmarshal(buf, &entry); err != nil || entry.ContainerID == "" {
+			c.log.Debugw("ignoring invalid CNI result",
+				zap.String("file", file.Name()),
+				zap.Error(err))
+
+			continue
+		}
+
+		out[entry.ContainerID] = append(out[entry.ContainerID], entry)
+	}
+
+	return out, nil
+}
+
+func (c *containerdSource) ListContainers() ([]string, error) {
+	results, err := c.readResults()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]string, 0, len(results))
+	for id := range results {
+		out = append(out, id)
+	}
+
+	sort.Strings(out)
+
+	return out, nil
+}
+
+// hostname returns hostname written by nerdctl to the container state directory,
+// layout is <state>/<data-store-hash>/containers/<namespace>/<id>/hostname.
+func (c *containerdSource) hostname(id string) string {
+	files, err := filepath.Glob(filepath.Join(c.state, "*", "containers", "*", id, "hostname"))
+	if err != nil || len(files) == 0 {
+		return ""
+	}
+
+	buf, err := os.ReadFile(files[0])
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(buf))
+}
+
+// name returns container name registered by nerdctl, layout is
+// <state>/<data-store-hash>/names/<namespace>/<name>, the file contains ID.
+// Container ID is used when the name is unknown.
+func (c *containerdSource) name(id string) string {
+	files, err := filepath.Glob(filepath.Join(c.state, "*", "names", "*", "*"))
+	if err != nil {
+		return id
+	}
+
+	for _, file := range files {
+		if buf, err := os.ReadFile(file); err == nil && strings.TrimSpace(string(buf)) == id {
+			return filepath.Base(file)
+		}
+	}
+
+	return id
+}
+
+func (c *containerdSource) InspectContainer(id string) (*Container, error) {
+	results, err := c.readResults()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, ok := results[id]
+	if !ok {
+		return nil, fmt.Errorf("container %s: %w", id, ErrNotFound)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].NetworkName < entries[j].NetworkName })
+
+	out := &Container{ID: id, Name: c.name(id), Hostname: c.hostname(id)}
+	for _, entry := range entries {
+		for _, item := range entry.Result.IPs {
+			if ip, _, err := net.ParseCIDR(item.Address); err == nil {
+				out.Addresses = appendIPv4(out.Addresses, ip.String())
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// poll compares current containers with known ones and emits start/die events.
+func (c *containerdSource) poll(ctx context.Context, out chan<- *Event) error {
+	list, err := c.ListContainers()
+	if err != nil {
+		return err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	alive := make(map[string]struct{}, len(list))
+	for _, id := range list {
+		alive[id] = struct{}{}
+
+		if _, ok := c.known[id]; !ok && !sendEvent(ctx, out, &Event{ID: id, Type: "container", Action: "start"}) {
+			return ctx.Err()
+		}
+	}
+
+	for id := range c.known {
+		if _, ok := alive[id]; !ok && !sendEvent(ctx, out, &Event{ID: id, Type: "container", Action: "die"}) {
+			return ctx.Err()
+		}
+	}
+
+	c.known = alive
+
+	return nil
+}
+
+func (c *containerdSource) AddEventListener(ctx context.Context, out chan<- *Event) error {
+	if _, err := os.Stat(c.results); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("CNI results directory %s: %w", c.results, err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(containerdPollInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := c.poll(ctx, out); err != nil && ctx.Err() == nil {
+				c.log.Warnw("could not poll containerd containers", zap.Error(err))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package dns
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/im-kulikov/go-bones/logger"
+)
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContainerdSource(t *testing.T) {
+	results, state := t.TempDir(), t.TempDir()
+
+	writeFile(t, filepath.Join(results, "bridge-abc-eth0"),
+		`{"kind":"cniCacheV1","containerId":"abc","networkName":"bridge","result":{"ips":[{"address":"10.4.0.2/24"}]}}`)
+	writeFile(t, filepath.Join(results, "bridge-def-eth0"),
+		`{"kind":"cniCacheV1","containerId":"def","networkName":"bridge","result":{"ips":[{"address":"10.4.0.3/24"}]}}`)
+	writeFile(t, filepath.Join(state, "1935db59", "containers", "default", "abc", "hostname"), "web.lan\n")
+	writeFile(t, filepath.Join(state, "1935db59", "names", "default", "web"), "abc")
+
+	src := newContainerdSource(results, state, logger.ForTests(t))
+
+	cases := []struct {
+		id       string
+		name     string
+		hostname string
+		address  string
+	}{
+		{id: "abc", name: "web", hostname: "web.lan", address: "10.4.0.2"},
+		{id: "def", name: "def", address: "10.4.0.3"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.id, func(t *testing.T) {
+			item, err := src.InspectContainer(tc.id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if item.Name != tc.name || item.Hostname != tc.hostname ||
+				len(item.Addresses) != 1 || item.Addresses[0].String() != tc.address {
+				t.Fatalf("unexpected container %+v", item)
+			}
+		})
+	}
+
+	t.Run("poll stops with context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		done := make(chan error, 1)
+		go func() { done <- src.poll(ctx, make(chan *Event)) }()
+
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Fatal("expected context error")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("poll is blocked on unread channel")
+		}
+	})
+}
@@ -0,0 +1,142 @@
+package dns
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/im-kulikov/go-bones/logger"
+)
+
+// dockerSource implements ContainerSource on top of Docker Engine API.
+type dockerSource struct {
+	cli *docker.Client
+	log logger.Logger
+}
+
+var _ ContainerSource = (*dockerSource)(nil)
+
+func newDockerSource(cli *docker.Client, log logger.Logger) *dockerSource {
+	return &dockerSource{cli: cli, log: log}
+}
+
+func fromDockerContainer(item *docker.Container) *Container {
+	out := &Container{
+		ID:     item.ID,
+		Name:   strings.TrimPrefix(item.Name, "/"),
+		Health: item.State.Health.Status,
+	}
+
+	if item.Config != nil {
+		out.Image = item.Config.Image
+		out.Labels = item.Config.Labels
+		out.Hostname = item.Config.Hostname
+	}
+
+	if item.NetworkSettings == nil {
+		return out
+	}
+
+	out.Addresses = appendIPv4(out.Addresses, item.NetworkSettings.IPAddress)
+
+	// keep stable order of networks
+	names := make([]string, 0, len(item.NetworkSettings.Networks))
+	for name := range item.NetworkSettings.Networks {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		out.Addresses = appendIPv4(out.Addresses, item.NetworkSettings.Networks[name].IPAddress)
+	}
+
+	return out
+}
+
+func (d *dockerSource) Ping(ctx context.Context) error { return d.cli.PingWithContext(ctx) }
+
+func (d *dockerSource) ListContainers() ([]string, error) {
+	containers, err := d.cli.ListContainers(docker.ListContainersOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]string, 0, len(containers))
+	for _, container := range containers {
+		out = append(out, container.ID)
+	}
+
+	return out, nil
+}
+
+func (d *dockerSource) InspectContainer(id string) (*Container, error) {
+	item, err := d.cli.InspectContainer(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return fromDockerContainer(item), nil
+}
+
+func (d *dockerSource) AddEventListener(ctx context.Context, out chan<- *Event) error {
+	in := make(chan *docker.APIEvents)
+	if err := d.cli.AddEventListener(in); err != nil {
+		return err
+	}
+
+	go func() {
+		for d.forward(ctx, in, out) {
+			// docker client closes listeners when events stream is lost
+			_ = d.cli.RemoveEventListener(in)
+
+			d.log.Warnw("docker events stream closed, reconnecting")
+
+			in = make(chan *docker.APIEvents)
+			if !waitFor(ctx, d.log, "docker events", func() error { return d.cli.AddEventListener(in) }) {
+				return
+			}
+
+			// events could be missed while we were not subscribed
+			if !sendEvent(ctx, out, &Event{Action: eventReconnect}) {
+				break
+			}
+		}
+
+		_ = d.cli.RemoveEventListener(in)
+	}()
+
+	return nil
+}
+
+// forward sends events of in to out, it returns true when in was closed
+// and false when ctx is done.
+func (d *dockerSource) forward(ctx context.Context, in chan *docker.APIEvents, out chan<- *Event) bool {
+	for {
+		var event *docker.APIEvents
+		select {
+		case <-ctx.Done():
+			return false
+		case event = <-in:
+		}
+
+		if event == nil {
+			return true
+		}
+
+		id, action := event.Actor.ID, event.Action
+		if id == "" {
+			id, action = event.ID, event.Status // API < 1.22
+		}
+
+		if !sendEvent(ctx, out, &Event{
+			ID:         id,
+			Type:       event.Type,
+			Action:     action,
+			Attributes: event.Actor.Attributes,
+		}) {
+			return false
+		}
+	}
+}
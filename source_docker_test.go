@@ -0,0 +1,73 @@
+package dns
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/im-kulikov/go-bones/logger"
+)
+
+func TestDockerSourceReconnect(t *testing.T) {
+	var calls atomic.Int32
+
+	stop := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/events" {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		// first stream is closed right away, next one is kept open
+		if calls.Add(1) == 1 {
+			return
+		}
+
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-r.Context().Done():
+		case <-stop:
+		}
+	}))
+	defer srv.Close()
+	defer close(stop)
+
+	cli, err := docker.NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	out := make(chan *Event)
+	src := newDockerSource(cli, logger.ForTests(t))
+	if err = src.AddEventListener(ctx, out); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case event := <-out:
+		if event.Action != eventReconnect {
+			t.Fatalf("expected reconnect event, got %+v", event)
+		}
+	case <-time.After(time.Second * 10):
+		t.Fatal("docker source did not reconnect")
+	}
+
+	// events stream is reopened by docker client in background
+	deadline := time.Now().Add(time.Second * 5)
+	for calls.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("events stream was not reopened")
+		}
+
+		time.Sleep(time.Millisecond * 5)
+	}
+}
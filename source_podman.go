@@ -0,0 +1,258 @@
+package dns
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/im-kulikov/go-bones/logger"
+	"go.uber.org/zap"
+)
+
+// podmanSource implements ContainerSource on top of Podman (libpod) REST API.
+type podmanSource struct {
+	uri *url.URL
+	cli *http.Client
+	log logger.Logger
+}
+
+type podmanContainer struct {
+	ID     string `json:"Id"`
+	Name   string `json:"Name"`
+	Config struct {
+		Image    string            `json:"Image"`
+		Labels   map[string]string `json:"Labels"`
+		Hostname string            `json:"Hostname"`
+	} `json:"Config"`
+	State struct {
+		Health struct {
+			Status string `json:"Status"`
+		} `json:"Health"`
+		// Podman < 4.3 used another name for the same field
+		Healthcheck struct {
+			Status string `json:"Status"`
+		} `json:"Healthcheck"`
+	} `json:"State"`
+	NetworkSettings struct {
+		IPAddress string `json:"IPAddress"`
+		Networks  map[string]struct {
+			IPAddress string `json:"IPAddress"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+type podmanEvent struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+}
+
+const (
+	podmanAPIPrefix   = "/v4.0.0/libpod"
+	podmanRetryDelay  = time.Second * 5
+	podmanCallTimeout = time.Second * 10
+)
+
+var _ ContainerSource = (*podmanSource)(nil)
+
+// newPodmanSource creates Podman client, endpoint could be unix:// socket or http(s):// address.
+func newPodmanSource(endpoint string, log logger.Logger) (*podmanSource, error) {
+	uri, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	switch uri.Scheme {
+	case "unix":
+		socket := uri.Path
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+
+		uri = &url.URL{Scheme: "http", Host: "podman"}
+	case "tcp":
+		uri.Scheme = "http"
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("podman endpoint %q: unsupported scheme", endpoint)
+	}
+
+	return &podmanSource{
+		uri: uri.JoinPath(podmanAPIPrefix),
+		cli: &http.Client{Transport: transport},
+		log: log,
+	}, nil
+}
+
+func (p *podmanSource) call(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	uri := p.uri.JoinPath(path)
+	uri.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := p.cli.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		defer closeIt(p.log, res.Body)
+
+		out, _ := io.ReadAll(res.Body)
+
+		return nil, fmt.Errorf("HTTP Error: %d\n%s", res.StatusCode, string(out))
+	}
+
+	return res, nil
+}
+
+func (p *podmanSource) decode(path string, query url.Values, out interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), podmanCallTimeout)
+	defer cancel()
+
+	res, err := p.call(ctx, path, query)
+	if err != nil {
+		return err
+	}
+
+	defer closeIt(p.log, res.Body)
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+func (p *podmanSource) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, podmanCallTimeout)
+	defer cancel()
+
+	res, err := p.call(ctx, "_ping", nil)
+	if err != nil {
+		return err
+	}
+
+	closeIt(p.log, res.Body)
+
+	return nil
+}
+
+func (p *podmanSource) ListContainers() ([]string, error) {
+	var list []struct {
+		ID string `json:"Id"`
+	}
+
+	if err := p.decode("containers/json", nil, &list); err != nil {
+		return nil, err
+	}
+
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		out = append(out, item.ID)
+	}
+
+	return out, nil
+}
+
+func (p *podmanSource) InspectContainer(id string) (*Container, error) {
+	var item podmanContainer
+	if err := p.decode("containers/"+url.PathEscape(id)+"/json", nil, &item); err != nil {
+		return nil, err
+	}
+
+	out := &Container{
+		ID:       item.ID,
+		Name:     item.Name,
+		Image:    item.Config.Image,
+		Labels:   item.Config.Labels,
+		Hostname: item.Config.Hostname,
+		Health:   item.State.Health.Status,
+	}
+
+	if out.Health == "" {
+		out.Health = item.State.Healthcheck.Status
+	}
+
+	out.Addresses = appendIPv4(out.Addresses, item.NetworkSettings.IPAddress)
+
+	names := make([]string, 0, len(item.NetworkSettings.Networks))
+	for name := range item.NetworkSettings.Networks {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		out.Addresses = appendIPv4(out.Addresses, item.NetworkSettings.Networks[name].IPAddress)
+	}
+
+	return out, nil
+}
+
+// streamEvents reads events stream until it's closed by Podman.
+func (p *podmanSource) streamEvents(ctx context.Context, out chan<- *Event) error {
+	res, err := p.call(ctx, "events", url.Values{
+		"stream":  {"true"},
+		"filters": {`{"type":["container"]}`},
+	})
+	if err != nil {
+		return err
+	}
+
+	defer closeIt(p.log, res.Body)
+
+	dec := json.NewDecoder(res.Body)
+	for {
+		var event podmanEvent
+		if err = dec.Decode(&event); err != nil {
+			return err
+		}
+
+		if !sendEvent(ctx, out, &Event{
+			ID:         event.Actor.ID,
+			Type:       event.Type,
+			Action:     strings.TrimSpace(event.Action),
+			Attributes: event.Actor.Attributes,
+		}) {
+			return ctx.Err()
+		}
+	}
+}
+
+func (p *podmanSource) AddEventListener(ctx context.Context, out chan<- *Event) error {
+	go func() {
+		for {
+			err := p.streamEvents(ctx, out)
+			if ctx.Err() != nil {
+				return
+			}
+
+			p.log.Warnw("podman events stream closed, reconnecting",
+				zap.Stringer("delay", podmanRetryDelay),
+				zap.Error(err))
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(podmanRetryDelay):
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,222 @@
+package dns
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/im-kulikov/go-bones/logger"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+// recordStore keeps records grouped by query and by owner (container,
+// service, etc.), so records of a single owner could be withdrawn.
+type recordStore struct {
+	log logger.Logger
+
+	// hooks are called after records were modified, without lock held
+	hooks []func()
+
+	// rot used to rotate answers of multi-record RRsets
+	rot atomic.Uint32
+
+	sync.RWMutex
+	rec map[dns.Question]map[string][]dns.RR
+	cnr map[string][]dns.Question
+}
+
+func newRecordStore(log logger.Logger) *recordStore {
+	return &recordStore{
+		log: log,
+		cnr: make(map[string][]dns.Question),
+		rec: make(map[dns.Question]map[string][]dns.RR),
+	}
+}
+
+func (r *recordStore) lookup(query dns.Question) ([]dns.RR, bool) {
+	set, ok := r.rec[query]
+	if !ok || len(set) == 0 {
+		return nil, false
+	}
+
+	// keep stable order of replicas, so rotation is fair
+	ids := make([]string, 0, len(set))
+	for oid := range set {
+		ids = append(ids, oid)
+	}
+
+	sort.Strings(ids)
+
+	msg := new(dns.Msg)
+	for _, oid := range ids {
+		msg.Answer = append(msg.Answer, set[oid]...)
+	}
+
+	r.log.Debugw("found record in cache",
+		Query(query).Fields(zap.Int("replicas", len(ids)))...)
+
+	return rotate(msg.Copy().Answer, r.rot.Add(1)), true
+}
+
+// Get returns records of exact name, when there are no such records,
+// records of the closest wildcard are returned.
+func (r *recordStore) Get(query dns.Question) ([]dns.RR, error) {
+	if rec, err := r.exact(query); err == nil {
+		return rec, nil
+	}
+
+	return r.wildcard(query)
+}
+
+func (r *recordStore) exact(query dns.Question) ([]dns.RR, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	if rec, ok := r.lookup(query); ok {
+		return rec, nil
+	}
+
+	return nil, ErrNotFound
+}
+
+// wildcard returns records of the closest wildcard, that covers the name.
+func (r *recordStore) wildcard(query dns.Question) ([]dns.RR, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	for _, name := range wildcardCandidates(query.Name) {
+		rec, ok := r.lookup(dns.Question{Name: name, Qtype: query.Qtype, Qclass: query.Qclass})
+		if !ok {
+			continue
+		}
+
+		for _, rr := range rec {
+			rr.Header().Name = query.Name
+		}
+
+		return rec, nil
+	}
+
+	return nil, ErrNotFound
+}
+
+// Set stores records of the owner (container) for passed query,
+// records of other owners (replicas) with the same query are kept.
+func (r *recordStore) Set(query dns.Question, oid string, rec []dns.RR) {
+	r.Lock()
+	r.setLocked(query, oid, rec)
+	r.Unlock()
+
+	r.changed()
+}
+
+func (r *recordStore) setLocked(query dns.Question, oid string, rec []dns.RR) {
+	msg := new(dns.Msg)
+	msg.Answer = rec
+
+	if _, ok := r.rec[query]; !ok {
+		r.rec[query] = make(map[string][]dns.RR)
+	}
+
+	r.rec[query][oid] = msg.Copy().Answer
+
+	for _, item := range r.cnr[oid] {
+		if item == query {
+			r.log.Debugw("updated record in cache",
+				Query(query).Fields(zap.String("owner", oid))...)
+
+			return
+		}
+	}
+
+	r.cnr[oid] = append(r.cnr[oid], query)
+
+	r.log.Debugw("added record to cache",
+		Query(query).Fields(zap.String("owner", oid))...)
+}
+
+// remove withdraws every record of the owner.
+func (r *recordStore) remove(oid string) {
+	r.Lock()
+	r.removeLocked(oid)
+	r.Unlock()
+
+	r.changed()
+}
+
+func (r *recordStore) removeLocked(oid string) {
+	if queries, ok := r.cnr[oid]; ok {
+		for _, query := range queries {
+			set, exists := r.rec[query]
+			if !exists {
+				continue
+			}
+
+			// remove only records of the owner, other replicas are kept
+			if delete(set, oid); len(set) == 0 {
+				delete(r.rec, query)
+			}
+
+			r.log.Debugw("removed record from cache",
+				Query(query).Fields(
+					zap.String("owner", oid),
+					zap.String("hostname", query.Name))...)
+		}
+	}
+
+	delete(r.cnr, oid)
+}
+
+// replace atomically replaces every record of the owner.
+func (r *recordStore) replace(oid string, records map[dns.Question][]dns.RR) {
+	r.Lock()
+	r.removeLocked(oid)
+
+	for query, rec := range records {
+		r.setLocked(query, oid, rec)
+	}
+	r.Unlock()
+
+	r.changed()
+}
+
+// subscribe adds hook, that is called on every change of records,
+// it must be called before the store is used.
+func (r *recordStore) subscribe(fn func()) { r.hooks = append(r.hooks, fn) }
+
+func (r *recordStore) changed() {
+	for _, fn := range r.hooks {
+		fn()
+	}
+}
+
+// dump returns copy of every record grouped by owner.
+func (r *recordStore) dump() map[string][]dns.RR {
+	r.RLock()
+	defer r.RUnlock()
+
+	out := make(map[string][]dns.RR, len(r.cnr))
+	for oid, queries := range r.cnr {
+		for _, query := range queries {
+			for _, rr := range r.rec[query][oid] {
+				out[oid] = append(out[oid], dns.Copy(rr))
+			}
+		}
+	}
+
+	return out
+}
+
+// owners returns identifiers of every owner that has records.
+func (r *recordStore) owners() []string {
+	r.RLock()
+	defer r.RUnlock()
+
+	out := make([]string, 0, len(r.cnr))
+	for oid := range r.cnr {
+		out = append(out, oid)
+	}
+
+	return out
+}
@@ -0,0 +1,260 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/im-kulikov/go-bones/logger"
+	"github.com/im-kulikov/go-bones/service"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+// SwarmClient is a part of Docker client that used to fetch Swarm services.
+type SwarmClient interface {
+	InspectService(string) (*swarm.Service, error)
+	ListServices(docker.ListServicesOptions) ([]swarm.Service, error)
+	ListTasks(docker.ListTasksOptions) ([]swarm.Task, error)
+	AddEventListener(chan<- *docker.APIEvents) error
+	RemoveEventListener(chan *docker.APIEvents) error
+}
+
+const (
+	// labelSwarmService is set by Docker on every task container.
+	labelSwarmService = "com.docker.swarm.service.id"
+
+	swarmTasksPrefix     = "tasks."
+	swarmRefreshInterval = time.Minute
+)
+
+// swarmCache publishes Swarm services as `<service>.<zone>` (service VIP)
+// and `tasks.<service>.<zone>` (IPs of running tasks).
+type swarmCache struct {
+	service.Service
+
+	cli  SwarmClient
+	log  logger.Logger
+	out  chan *docker.APIEvents
+	zone string
+
+	*recordStore
+}
+
+// NewSwarmCache creates records source for Swarm services of the host.
+func NewSwarmCache(cfg Config, host DockerHostConfig, cli SwarmClient, log logger.Logger) (CacheWorker, error) {
+	zone := strings.Trim(cfg.SwarmZone, ".")
+	if host.Subdomain != "" {
+		zone = host.Subdomain + "." + zone
+	}
+
+	svc := swarmCache{
+		cli:  cli,
+		log:  log,
+		out:  make(chan *docker.APIEvents),
+		zone: zone,
+
+		recordStore: newRecordStore(log),
+	}
+
+	svc.Service = service.NewWorker("docker-swarm-cache-"+host.Name, svc.Run)
+
+	return &svc, nil
+}
+
+func swarmRecords(name string, addresses []string) []dns.RR {
+	out := make([]dns.RR, 0, len(addresses))
+	for _, address := range addresses {
+		// swarm returns addresses in CIDR notation
+		ip, _, err := net.ParseCIDR(address)
+		if err != nil {
+			continue
+		}
+
+		hdr := dns.RR_Header{Name: name, Class: dns.ClassINET, Ttl: 60}
+		if ip4 := ip.To4(); ip4 != nil {
+			hdr.Rrtype = dns.TypeA
+			out = append(out, &dns.A{Hdr: hdr, A: ip4})
+
+			continue
+		}
+
+		hdr.Rrtype = dns.TypeAAAA
+		out = append(out, &dns.AAAA{Hdr: hdr, AAAA: ip})
+	}
+
+	return out
+}
+
+// groupRecords groups records by question, so they could be stored.
+func groupRecords(records []dns.RR) map[dns.Question][]dns.RR {
+	out := make(map[dns.Question][]dns.RR)
+	for _, rr := range records {
+		hdr := rr.Header()
+		query := dns.Question{Name: hdr.Name, Qtype: hdr.Rrtype, Qclass: hdr.Class}
+
+		out[query] = append(out[query], rr)
+	}
+
+	return out
+}
+
+func (s *swarmCache) taskAddresses(id string) ([]string, error) {
+	tasks, err := s.cli.ListTasks(docker.ListTasksOptions{
+		Filters: map[string][]string{"service": {id}, "desired-state": {"running"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for _, task := range tasks {
+		if task.Status.State != swarm.TaskStateRunning {
+			continue
+		}
+
+		for _, network := range task.NetworksAttachments {
+			out = append(out, network.Addresses...)
+		}
+	}
+
+	return out, nil
+}
+
+func (s *swarmCache) refreshService(id string) {
+	svc, err := s.cli.InspectService(id)
+
+	var missing *docker.NoSuchService
+	if errors.As(err, &missing) {
+		s.remove(id)
+
+		return
+	} else if err != nil {
+		s.log.Warnw("could not inspect service",
+			zap.String("service", id),
+			zap.Error(err))
+
+		return
+	}
+
+	var tasks []string
+	if tasks, err = s.taskAddresses(id); err != nil {
+		s.log.Warnw("could not list service tasks",
+			zap.String("service", id),
+			zap.Error(err))
+
+		return
+	}
+
+	name := dns.Fqdn(svc.Spec.Name + "." + s.zone)
+
+	vips := make([]string, 0, len(svc.Endpoint.VirtualIPs))
+	for _, vip := range svc.Endpoint.VirtualIPs {
+		vips = append(vips, vip.Addr)
+	}
+
+	// services in dnsrr mode have no VIP, so the name points to the tasks
+	if len(vips) == 0 {
+		vips = tasks
+	}
+
+	records := swarmRecords(name, vips)
+	records = append(records, swarmRecords(swarmTasksPrefix+name, tasks)...)
+
+	s.replace(id, groupRecords(records))
+
+	s.log.Debugw("swarm service refreshed",
+		zap.String("service", id),
+		zap.String("name", name),
+		zap.Int("vips", len(vips)),
+		zap.Int("tasks", len(tasks)))
+}
+
+func (s *swarmCache) refreshAll() {
+	services, err := s.cli.ListServices(docker.ListServicesOptions{})
+	if err != nil {
+		s.log.Warnw("could not list swarm services", zap.Error(err))
+
+		return
+	}
+
+	alive := make(map[string]struct{}, len(services))
+	for _, svc := range services {
+		alive[svc.ID] = struct{}{}
+
+		s.refreshService(svc.ID)
+	}
+
+	for _, id := range s.owners() {
+		if _, ok := alive[id]; !ok {
+			s.remove(id)
+		}
+	}
+}
+
+func (s *swarmCache) handleEvent(event *docker.APIEvents) {
+	switch event.Type {
+	case "service":
+		if event.Action == "remove" {
+			s.remove(event.Actor.ID)
+
+			return
+		}
+
+		s.refreshService(event.Actor.ID)
+	case "container":
+		// task containers are started and stopped by swarm
+		if id, ok := event.Actor.Attributes[labelSwarmService]; ok {
+			s.refreshService(id)
+		}
+	}
+}
+
+func (s *swarmCache) subscribe(ctx context.Context) bool {
+	return waitFor(ctx, s.log, "swarm events", func() error { return s.cli.AddEventListener(s.out) })
+}
+
+func (s *swarmCache) Run(ctx context.Context) error {
+	if !s.subscribe(ctx) {
+		return nil
+	}
+
+	ticker := time.NewTimer(time.Microsecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			s.refreshAll()
+
+			ticker.Reset(swarmRefreshInterval)
+		case event, ok := <-s.out:
+			if ok && event != nil {
+				s.handleEvent(event)
+
+				continue
+			}
+
+			// docker client closes listeners when events stream is lost
+			s.log.Warnw("swarm events stream closed, resubscribing")
+
+			_ = s.cli.RemoveEventListener(s.out)
+			if !ok {
+				s.out = make(chan *docker.APIEvents)
+			}
+
+			if !s.subscribe(ctx) {
+				return nil
+			}
+
+			// events could be missed while we were not subscribed
+			s.refreshAll()
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package dns
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/swarm"
+	docker "github.com/fsouza/go-dockerclient"
+	"github.com/im-kulikov/go-bones/logger"
+	"github.com/miekg/dns"
+)
+
+type fakeSwarm struct {
+	sync.Mutex
+
+	lists    int
+	services []swarm.Service
+	subs     chan chan<- *docker.APIEvents
+}
+
+func (f *fakeSwarm) InspectService(id string) (*swarm.Service, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	for i := range f.services {
+		if f.services[i].ID == id {
+			return &f.services[i], nil
+		}
+	}
+
+	return nil, &docker.NoSuchService{ID: id}
+}
+
+func (f *fakeSwarm) ListServices(docker.ListServicesOptions) ([]swarm.Service, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.lists++
+
+	return append([]swarm.Service(nil), f.services...), nil
+}
+
+func (*fakeSwarm) ListTasks(docker.ListTasksOptions) ([]swarm.Task, error) { return nil, nil }
+
+func (f *fakeSwarm) AddEventListener(out chan<- *docker.APIEvents) error {
+	f.subs <- out
+
+	return nil
+}
+
+func (*fakeSwarm) RemoveEventListener(chan *docker.APIEvents) error { return nil }
+
+func (f *fakeSwarm) listed() int {
+	f.Lock()
+	defer f.Unlock()
+
+	return f.lists
+}
+
+func TestSwarmCacheResubscribe(t *testing.T) {
+	cli := &fakeSwarm{subs: make(chan chan<- *docker.APIEvents, 1)}
+	svc, err := NewSwarmCache(Config{SwarmZone: "swarm"}, DockerHostConfig{}, cli, logger.ForTests(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- svc.(*swarmCache).Run(ctx) }()
+
+	var out chan<- *docker.APIEvents
+	select {
+	case out = <-cli.subs:
+	case <-time.After(time.Second):
+		t.Fatal("swarm cache did not subscribe to events")
+	}
+
+	// wait for initial refresh, next one is a minute away
+	deadline := time.Now().Add(time.Second)
+	for cli.listed() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("swarm services were not listed")
+		}
+
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	// service appears while events stream is lost
+	cli.Lock()
+	cli.services = append(cli.services, swarm.Service{
+		ID:       "s1",
+		Spec:     swarm.ServiceSpec{Annotations: swarm.Annotations{Name: "web"}},
+		Endpoint: swarm.Endpoint{VirtualIPs: []swarm.EndpointVirtualIP{{Addr: "10.0.0.2/24"}}},
+	})
+	cli.Unlock()
+
+	close(out)
+
+	select {
+	case <-cli.subs:
+	case <-time.After(time.Second):
+		t.Fatal("swarm cache did not resubscribe to events")
+	}
+
+	deadline = time.Now().Add(time.Second)
+	for {
+		rec, _ := svc.Get(testQuestion("web.swarm.", dns.TypeA))
+		if len(rec) == 1 && rec[0].(*dns.A).A.String() == "10.0.0.2" {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("expected refreshed service record, got %v", rec)
+		}
+
+		time.Sleep(time.Millisecond * 5)
+	}
+
+	cancel()
+
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,279 @@
+package dns
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+const notifyTimeout = time.Second * 5
+
+// TransferConfig allows secondaries to transfer the container zone.
+type TransferConfig struct {
+	Zone        string   `env:"ZONE" default:""`
+	PrimaryNS   string   `env:"PRIMARY_NS" default:""`
+	Secondaries []string `env:"SECONDARIES" default:""`
+	ACL         []string `env:"ACL" default:"127.0.0.1/32,::1/128"`
+
+	TSIGName      string `env:"TSIG_NAME" default:""`
+	TSIGSecret    string `env:"TSIG_SECRET" default:""`
+	TSIGAlgorithm string `env:"TSIG_ALGORITHM" default:"hmac-sha256."`
+}
+
+// Validate checks ACL networks and TSIG secret.
+func (c TransferConfig) Validate() error {
+	for _, item := range c.ACL {
+		if _, _, err := net.ParseCIDR(strings.TrimSpace(item)); err != nil {
+			return fmt.Errorf("transfer acl %q: %w", item, err)
+		}
+	}
+
+	if c.TSIGName == "" {
+		return nil
+	}
+
+	if _, err := base64.StdEncoding.DecodeString(c.TSIGSecret); err != nil {
+		return fmt.Errorf("transfer tsig secret: %w", err)
+	}
+
+	return nil
+}
+
+func (c TransferConfig) tsigSecrets() map[string]string {
+	if c.TSIGName == "" {
+		return nil
+	}
+
+	return map[string]string{dns.CanonicalName(c.TSIGName): c.TSIGSecret}
+}
+
+func (c TransferConfig) acl() []*net.IPNet {
+	out := make([]*net.IPNet, 0, len(c.ACL))
+	for _, item := range c.ACL {
+		if _, network, err := net.ParseCIDR(strings.TrimSpace(item)); err == nil {
+			out = append(out, network)
+		}
+	}
+
+	return out
+}
+
+func remoteIP(w dns.ResponseWriter) net.IP {
+	switch addr := w.RemoteAddr().(type) {
+	case *net.UDPAddr:
+		return addr.IP
+	case *net.TCPAddr:
+		return addr.IP
+	default:
+		return nil
+	}
+}
+
+// allowTransfer checks ACL and TSIG of the transfer request.
+func (s *server) allowTransfer(w dns.ResponseWriter, req *dns.Msg) bool {
+	ip := remoteIP(w)
+
+	allowed := false
+	for _, network := range s.acl {
+		if ip != nil && network.Contains(ip) {
+			allowed = true
+
+			break
+		}
+	}
+
+	if !allowed {
+		s.logger.Warnw("zone transfer denied by ACL",
+			Queries(req.Question).Fields(zap.Stringer("remote", w.RemoteAddr()))...)
+
+		return false
+	}
+
+	if s.xfr.TSIGName == "" {
+		return true
+	}
+
+	if req.IsTsig() == nil || w.TsigStatus() != nil {
+		s.logger.Warnw("zone transfer denied, invalid TSIG",
+			Queries(req.Question).Fields(
+				zap.Stringer("remote", w.RemoteAddr()),
+				zap.Error(w.TsigStatus()))...)
+
+		return false
+	}
+
+	return true
+}
+
+func (s *server) refuse(w dns.ResponseWriter, req *dns.Msg, code int) {
+	reply := new(dns.Msg)
+	reply.SetRcode(req, code)
+
+	if err := w.WriteMsg(reply); err != nil {
+		s.logger.Errorw("could not write reply",
+			Queries(req.Question).Fields(zap.Error(err))...)
+	}
+}
+
+// isTransfer returns true for AXFR/IXFR requests of the zone.
+func (s *server) isTransfer(req *dns.Msg) bool {
+	if s.zone == nil || len(req.Question) != 1 {
+		return false
+	}
+
+	q := req.Question[0]
+
+	return (q.Qtype == dns.TypeAXFR || q.Qtype == dns.TypeIXFR) && strings.EqualFold(q.Name, s.zone.name)
+}
+
+func (s *server) serveTransfer(w dns.ResponseWriter, req *dns.Msg) {
+	if !s.allowTransfer(w, req) {
+		s.refuse(w, req, dns.RcodeRefused)
+
+		return
+	}
+
+	_, udp := w.RemoteAddr().(*net.UDPAddr)
+
+	var records []dns.RR
+	switch q := req.Question[0]; q.Qtype {
+	case dns.TypeIXFR:
+		var from uint32
+		for _, rr := range req.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				from = soa.Serial
+			}
+		}
+
+		var ok bool
+		if records, ok = s.zone.ixfr(from); !ok {
+			records = s.zone.axfr()
+		}
+
+		// response doesn't fit into UDP, client should retry over TCP (RFC 1995)
+		if udp && len(records) > 1 {
+			records = []dns.RR{s.zone.soa(s.zone.Serial())}
+		}
+	case dns.TypeAXFR:
+		if udp {
+			s.refuse(w, req, dns.RcodeRefused)
+
+			return
+		}
+
+		records = s.zone.axfr()
+	}
+
+	s.logger.Infow("zone transfer",
+		Queries(req.Question).Fields(
+			zap.Stringer("remote", w.RemoteAddr()),
+			zap.Uint32("serial", s.zone.Serial()),
+			zap.Int("records", len(records)))...)
+
+	out := make(chan *dns.Envelope)
+	tr := new(dns.Transfer)
+
+	go func() {
+		defer close(out)
+
+		// send records by chunks, to not overflow the message
+		for len(records) > 0 {
+			end := 100
+			if end > len(records) {
+				end = len(records)
+			}
+
+			out <- &dns.Envelope{RR: records[:end]}
+			records = records[end:]
+		}
+	}()
+
+	if err := tr.Out(w, req, out); err != nil {
+		s.logger.Errorw("could not transfer zone",
+			Queries(req.Question).Fields(zap.Error(err))...)
+
+		// drain, so the producer is not blocked
+		for range out { //nolint:revive
+		}
+	}
+
+	if err := w.Close(); err != nil && !udp {
+		s.logger.Debugw("could not close transfer connection", zap.Error(err))
+	}
+}
+
+// notify sends NOTIFY to every configured secondary.
+func (s *server) notify() {
+	serial := s.zone.Serial()
+
+	for _, secondary := range s.xfr.Secondaries {
+		if secondary = strings.TrimSpace(secondary); secondary == "" {
+			continue
+		}
+
+		go func(address string) {
+			msg := new(dns.Msg)
+			msg.SetNotify(s.zone.name)
+			msg.Answer = []dns.RR{s.zone.soa(serial)}
+
+			cli := &dns.Client{Net: "udp", Timeout: notifyTimeout, TsigSecret: s.xfr.tsigSecrets()}
+			if s.xfr.TSIGName != "" {
+				msg.SetTsig(dns.CanonicalName(s.xfr.TSIGName), s.xfr.TSIGAlgorithm, 300, time.Now().Unix())
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			defer cancel()
+
+			if _, _, err := cli.ExchangeContext(ctx, msg, address); err != nil {
+				s.logger.Warnw("could not notify secondary",
+					zap.String("secondary", address),
+					zap.Uint32("serial", serial),
+					zap.Error(err))
+
+				return
+			}
+
+			s.logger.Debugw("secondary notified",
+				zap.String("secondary", address),
+				zap.Uint32("serial", serial))
+		}(secondary)
+	}
+}
+
+// zoneChanged is called on every change of container records,
+// zone is reloaded by watchZone, so writers are not blocked.
+func (s *server) zoneChanged() {
+	select {
+	case s.dty <- struct{}{}:
+	default:
+	}
+}
+
+// watchZone reloads the zone, persists its serial and notifies secondaries.
+func (s *server) watchZone(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.dty:
+		}
+
+		if !s.zone.update() {
+			continue
+		}
+
+		if err := s.ser.save(s.zone.Serial()); err != nil {
+			s.logger.Warnw("could not persist zone serial",
+				zap.String("zone", s.zone.name),
+				zap.Error(err))
+		}
+
+		s.notify()
+	}
+}
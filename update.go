@@ -0,0 +1,352 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/im-kulikov/go-bones/logger"
+	"github.com/im-kulikov/go-bones/service"
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+)
+
+type updater struct {
+	service.Service
+
+	cfg UpdateConfig
+	cli *dns.Client
+	log logger.Logger
+	src []watchable
+	zns []string
+
+	// dty notifies that records were changed
+	dty chan struct{}
+
+	// pushed records by rr.String(), accessed from Run loop only
+	pushed map[string]dns.RR
+}
+
+// ownerTTL is TTL of TXT records, that mark names owned by docker-dns.
+const ownerTTL = 3600
+
+// NewUpdater creates worker, that pushes A, AAAA and PTR records of
+// containers to the primary server using dynamic updates (RFC 2136).
+func NewUpdater(cfg UpdateConfig, log logger.Logger, hosts ...*Host) (service.Service, error) {
+	svc := updater{
+		cfg: cfg,
+		log: log,
+		src: hostSources(hosts),
+		zns: cfg.zones(),
+		dty: make(chan struct{}, 1),
+		cli: &dns.Client{
+			Net:        cfg.Network,
+			Timeout:    cfg.Timeout,
+			TsigSecret: cfg.tsigSecrets(),
+		},
+
+		pushed: make(map[string]dns.RR),
+	}
+
+	if len(svc.src) == 0 {
+		return nil, fmt.Errorf("dynamic update: %w", ErrNotFound)
+	}
+
+	for _, src := range svc.src {
+		src.subscribe(svc.changed)
+	}
+
+	svc.Service = service.NewWorker("docker-dns-update", svc.Run)
+
+	return &svc, nil
+}
+
+func (u *updater) changed() {
+	select {
+	case u.dty <- struct{}{}:
+	default:
+	}
+}
+
+// zoneOf returns the closest configured zone of the name.
+func (u *updater) zoneOf(name string) string {
+	var out string
+	for _, zone := range u.zns {
+		if dns.IsSubDomain(zone, strings.ToLower(name)) && len(zone) > len(out) {
+			out = zone
+		}
+	}
+
+	return out
+}
+
+// owner returns TXT record, that marks the name as owned by docker-dns.
+func (u *updater) owner(name string) *dns.TXT {
+	return &dns.TXT{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeTXT,
+			Class:  dns.ClassINET,
+			Ttl:    ownerTTL,
+		},
+		Txt: []string{"heritage=docker-dns,owner=" + u.cfg.Owner},
+	}
+}
+
+// isOwner checks that the record is ownership mark of this instance.
+func (u *updater) isOwner(rr dns.RR) bool {
+	txt, ok := rr.(*dns.TXT)
+
+	return ok && len(txt.Txt) == 1 && txt.Txt[0] == u.owner(txt.Hdr.Name).Txt[0]
+}
+
+// desired returns records, that should be present at the primary,
+// every name is marked by the owner TXT record.
+func (u *updater) desired() map[string]dns.RR {
+	out := make(map[string]dns.RR)
+	for _, rr := range dumpSources(u.src) {
+		switch rr.Header().Rrtype {
+		case dns.TypeA, dns.TypeAAAA, dns.TypePTR:
+		default:
+			continue
+		}
+
+		if u.zoneOf(rr.Header().Name) == "" {
+			continue
+		}
+
+		out[rr.String()] = rr
+
+		mark := u.owner(rr.Header().Name)
+		out[mark.String()] = mark
+	}
+
+	return out
+}
+
+// owned returns records at the primary, that are owned by this instance.
+// Names are owned when they have owner TXT record, so records of containers,
+// that were removed while we were offline, are found too. Desired names are
+// claimed as well. Owned names are exclusive: every A, AAAA and PTR record
+// of the name is treated as ours, other names are never touched.
+func (u *updater) owned(zone string, desired map[string]dns.RR) (map[string]dns.RR, error) {
+	req := new(dns.Msg)
+	req.SetAxfr(zone)
+
+	if u.cfg.TSIGName != "" {
+		req.SetTsig(dns.CanonicalName(u.cfg.TSIGName), u.cfg.TSIGAlgorithm, 300, time.Now().Unix())
+	}
+
+	tr := &dns.Transfer{
+		DialTimeout:  u.cfg.Timeout,
+		ReadTimeout:  u.cfg.Timeout,
+		WriteTimeout: u.cfg.Timeout,
+		TsigSecret:   u.cfg.tsigSecrets(),
+	}
+
+	envelopes, err := tr.In(req, u.cfg.Primary)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []dns.RR
+	for env := range envelopes {
+		if env.Error != nil {
+			// drain, so the reader is not blocked
+			for range envelopes { //nolint:revive
+			}
+
+			return nil, env.Error
+		}
+
+		records = append(records, env.RR...)
+	}
+
+	names := make(map[string]struct{})
+	for _, rr := range desired {
+		names[strings.ToLower(rr.Header().Name)] = struct{}{}
+	}
+
+	for _, rr := range records {
+		if u.isOwner(rr) {
+			names[strings.ToLower(rr.Header().Name)] = struct{}{}
+		}
+	}
+
+	out := make(map[string]dns.RR)
+	for _, rr := range records {
+		if _, ok := names[strings.ToLower(rr.Header().Name)]; !ok {
+			continue
+		}
+
+		switch rr.Header().Rrtype {
+		case dns.TypeA, dns.TypeAAAA, dns.TypePTR:
+		case dns.TypeTXT:
+			if !u.isOwner(rr) {
+				continue
+			}
+		default:
+			continue
+		}
+
+		// zone closest to the name could be another configured zone
+		if u.zoneOf(rr.Header().Name) == zone {
+			out[rr.String()] = rr
+		}
+	}
+
+	return out, nil
+}
+
+// current returns records, that should be removed when they're not desired.
+// On full sync it adds records owned at the primary, so they're removed too.
+func (u *updater) current(desired map[string]dns.RR, full bool) map[string]dns.RR {
+	out := make(map[string]dns.RR, len(u.pushed))
+	for key, rr := range u.pushed {
+		out[key] = rr
+	}
+
+	if !full {
+		return out
+	}
+
+	for _, zone := range u.zns {
+		owned, err := u.owned(zone, desired)
+		if err != nil {
+			u.log.Warnw("could not transfer zone to find owned records",
+				zap.String("zone", zone),
+				zap.Error(err))
+
+			continue
+		}
+
+		for key, rr := range owned {
+			out[key] = rr
+		}
+	}
+
+	return out
+}
+
+// sync sends the difference between desired and pushed records. On full sync
+// desired records are re-added and owned records, that are not desired, are
+// removed one by one, so drift at the primary is fixed.
+func (u *updater) sync(ctx context.Context, full bool) {
+	desired := u.desired()
+	current := u.current(desired, full)
+
+	type change struct {
+		msg     *dns.Msg
+		added   []string
+		removed []string
+	}
+
+	changes := make(map[string]*change)
+	get := func(name string) *change {
+		zone := u.zoneOf(name)
+		if _, ok := changes[zone]; !ok {
+			msg := new(dns.Msg)
+			msg.SetUpdate(zone)
+
+			changes[zone] = &change{msg: msg}
+		}
+
+		return changes[zone]
+	}
+
+	for key, rr := range current {
+		if _, ok := desired[key]; !ok {
+			item := get(rr.Header().Name)
+			item.msg.Remove([]dns.RR{rr})
+			item.removed = append(item.removed, key)
+		}
+	}
+
+	for key, rr := range desired {
+		if _, ok := current[key]; ok && !full {
+			continue
+		}
+
+		item := get(rr.Header().Name)
+		item.msg.Insert([]dns.RR{rr})
+		item.added = append(item.added, key)
+	}
+
+	for zone, item := range changes {
+		var err error
+		if !waitFor(ctx, u.log, "dynamic update of "+zone, func() error {
+			// refused updates are not retried, they don't block other zones
+			if err = u.send(item.msg); errors.Is(err, ErrUpdateRefused) {
+				return nil
+			}
+
+			return err
+		}) {
+			return
+		}
+
+		if err != nil {
+			u.log.Errorw("dynamic update rejected by primary",
+				zap.String("zone", zone),
+				zap.Error(err))
+
+			continue
+		}
+
+		for _, key := range item.removed {
+			delete(u.pushed, key)
+		}
+
+		for _, key := range item.added {
+			u.pushed[key] = desired[key]
+		}
+
+		u.log.Infow("zone updated",
+			zap.String("zone", zone),
+			zap.Bool("full", full),
+			zap.Int("added", len(item.added)),
+			zap.Int("removed", len(item.removed)))
+	}
+}
+
+func (u *updater) send(msg *dns.Msg) error {
+	req := msg.Copy()
+	if u.cfg.TSIGName != "" {
+		req.SetTsig(dns.CanonicalName(u.cfg.TSIGName), u.cfg.TSIGAlgorithm, 300, time.Now().Unix())
+	}
+
+	res, _, err := u.cli.Exchange(req, u.cfg.Primary)
+	if err != nil {
+		return err
+	}
+
+	switch res.Rcode {
+	case dns.RcodeSuccess:
+		return nil
+	case dns.RcodeNotAuth, dns.RcodeRefused, dns.RcodeNotZone, dns.RcodeNotImplemented, dns.RcodeFormatError:
+		// permanent errors, retry doesn't help until configuration is fixed
+		return fmt.Errorf("%w: %s", ErrUpdateRefused, dns.RcodeToString[res.Rcode])
+	default:
+		return fmt.Errorf("%w: %s", ErrUpdateFailed, dns.RcodeToString[res.Rcode])
+	}
+}
+
+func (u *updater) Run(ctx context.Context) error {
+	ticker := time.NewTicker(u.cfg.Interval)
+	defer ticker.Stop()
+
+	u.sync(ctx, true)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-u.dty:
+			u.sync(ctx, false)
+		case <-ticker.C:
+			u.sync(ctx, true)
+		}
+	}
+}
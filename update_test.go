@@ -0,0 +1,233 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/im-kulikov/go-bones/logger"
+	"github.com/miekg/dns"
+)
+
+// fakePrimary is authoritative server, that accepts dynamic updates and AXFR.
+type fakePrimary struct {
+	sync.Mutex
+
+	zone    string
+	rcode   int
+	updates int
+	records map[string]dns.RR
+}
+
+func (p *fakePrimary) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	p.Lock()
+	defer p.Unlock()
+
+	if req.Opcode == dns.OpcodeUpdate {
+		p.updates++
+
+		reply := new(dns.Msg)
+		if reply.SetRcode(req, p.rcode); p.rcode == dns.RcodeSuccess {
+			p.apply(req.Ns)
+		}
+
+		_ = w.WriteMsg(reply)
+
+		return
+	}
+
+	soa := &dns.SOA{Hdr: dns.RR_Header{Name: p.zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET}, Ns: "ns." + p.zone, Mbox: "hostmaster." + p.zone}
+
+	list := []dns.RR{soa}
+	for _, rr := range p.records {
+		list = append(list, rr)
+	}
+
+	out := make(chan *dns.Envelope, 1)
+	out <- &dns.Envelope{RR: append(list, soa)}
+	close(out)
+
+	_ = new(dns.Transfer).Out(w, req, out)
+	_ = w.Close()
+}
+
+func (p *fakePrimary) apply(list []dns.RR) {
+	for _, rr := range list {
+		switch hdr := rr.Header(); hdr.Class {
+		case dns.ClassNONE:
+			hdr.Class = dns.ClassINET
+			for key, item := range p.records {
+				if dns.IsDuplicate(item, rr) {
+					delete(p.records, key)
+				}
+			}
+		case dns.ClassANY:
+			for key, item := range p.records {
+				if item.Header().Name == hdr.Name && item.Header().Rrtype == hdr.Rrtype {
+					delete(p.records, key)
+				}
+			}
+		default:
+			p.records[rr.String()] = rr
+		}
+	}
+}
+
+func (p *fakePrimary) keys() []string {
+	p.Lock()
+	defer p.Unlock()
+
+	out := make([]string, 0, len(p.records))
+	for key := range p.records {
+		out = append(out, key)
+	}
+
+	sort.Strings(out)
+
+	return out
+}
+
+func newFakePrimary(t *testing.T, rcode int, records ...dns.RR) (*fakePrimary, string) {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	primary := &fakePrimary{zone: "docker.lan.", rcode: rcode, records: make(map[string]dns.RR)}
+	for _, rr := range records {
+		primary.records[rr.String()] = rr
+	}
+
+	srv := &dns.Server{Listener: lis, Handler: primary, MsgAcceptFunc: func(dns.Header) dns.MsgAcceptAction {
+		// default function rejects dynamic updates
+		return dns.MsgAccept
+	}}
+	go func() { _ = srv.ActivateAndServe() }()
+
+	t.Cleanup(func() { _ = srv.Shutdown() })
+
+	return primary, lis.Addr().String()
+}
+
+func newTestUpdater(t *testing.T, address string, src *recordStore) *updater {
+	cfg := UpdateConfig{
+		Enabled: true,
+		Primary: address,
+		Network: "tcp",
+		Zones:   []string{"docker.lan"},
+		Owner:   "test",
+		Timeout: time.Second,
+	}
+
+	return &updater{
+		cfg:    cfg,
+		log:    logger.ForTests(t),
+		src:    []watchable{src},
+		zns:    cfg.zones(),
+		cli:    &dns.Client{Net: cfg.Network, Timeout: cfg.Timeout},
+		pushed: make(map[string]dns.RR),
+	}
+}
+
+func TestUpdaterRemovesOwnedRecords(t *testing.T) {
+	src := newRecordStore(logger.ForTests(t))
+	src.replace("web", groupRecords([]dns.RR{testA("web.docker.lan.", "10.0.0.1")}))
+
+	upd := newTestUpdater(t, "", src)
+
+	// records of removed container, owned by us, and record of another owner
+	primary, address := newFakePrimary(t, dns.RcodeSuccess,
+		testA("old.docker.lan.", "10.0.0.2"), upd.owner("old.docker.lan."),
+		testA("static.docker.lan.", "10.0.0.3"))
+
+	upd.cfg.Primary = address
+	upd.sync(context.Background(), true)
+
+	want := []string{
+		testA("static.docker.lan.", "10.0.0.3").String(),
+		testA("web.docker.lan.", "10.0.0.1").String(),
+		upd.owner("web.docker.lan.").String(),
+	}
+	sort.Strings(want)
+
+	got := primary.keys()
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestUpdaterRefused(t *testing.T) {
+	src := newRecordStore(logger.ForTests(t))
+	src.replace("web", groupRecords([]dns.RR{testA("web.docker.lan.", "10.0.0.1")}))
+
+	primary, address := newFakePrimary(t, dns.RcodeRefused)
+	upd := newTestUpdater(t, address, src)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		upd.sync(context.Background(), false)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("refused update should not be retried")
+	}
+
+	if primary.updates != 1 || len(upd.pushed) != 0 {
+		t.Fatalf("expected single rejected update, got %d updates and %d pushed", primary.updates, len(upd.pushed))
+	}
+}
+
+// TestUpdaterExclusiveNames checks that names published by docker-dns are
+// exclusive, records of another writer at these names are removed.
+func TestUpdaterExclusiveNames(t *testing.T) {
+	src := newRecordStore(logger.ForTests(t))
+	src.replace("web", groupRecords([]dns.RR{testA("web.docker.lan.", "10.0.0.1")}))
+	src.replace("api", groupRecords([]dns.RR{testA("api.docker.lan.", "10.0.0.2")}))
+
+	upd := newTestUpdater(t, "", src)
+
+	// web is written by another client too, api is owned by us and drifted,
+	// db is written by another client only
+	primary, address := newFakePrimary(t, dns.RcodeSuccess,
+		testA("web.docker.lan.", "10.0.0.9"),
+		testA("api.docker.lan.", "10.0.0.8"), upd.owner("api.docker.lan."),
+		testA("db.docker.lan.", "10.0.0.7"))
+
+	upd.cfg.Primary = address
+	upd.sync(context.Background(), true)
+
+	want := []string{
+		testA("api.docker.lan.", "10.0.0.2").String(),
+		upd.owner("api.docker.lan.").String(),
+		testA("db.docker.lan.", "10.0.0.7").String(),
+		testA("web.docker.lan.", "10.0.0.1").String(),
+		upd.owner("web.docker.lan.").String(),
+	}
+	sort.Strings(want)
+
+	got := primary.keys()
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package dns
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// labelWildcard allows container to own every name under its hostname.
+const labelWildcard = "docker-dns.wildcard"
+
+func isWildcard(container *Container) bool {
+	return container.Labels[labelWildcard] == "true"
+}
+
+// wildcardName returns wildcard owner name for passed FQDN.
+func wildcardName(name string) string { return "*." + name }
+
+// wildcardCandidates returns wildcard names that could cover passed FQDN,
+// from the closest encloser to the farthest one.
+func wildcardCandidates(name string) []string {
+	labels := dns.SplitDomainName(name)
+	if len(labels) < 2 {
+		return nil
+	}
+
+	out := make([]string, 0, len(labels)-1)
+	for i := 1; i < len(labels); i++ {
+		out = append(out, wildcardName(dns.Fqdn(strings.Join(labels[i:], "."))))
+	}
+
+	return out
+}
+
+// isSubdomainOf returns true when name is a strict subdomain of parent.
+func isSubdomainOf(name, parent string) bool {
+	return name != parent && dns.IsSubDomain(parent, name)
+}
@@ -0,0 +1,312 @@
+package dns
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// zoneJournalSize limits the number of diffs kept for IXFR.
+const zoneJournalSize = 128
+
+// zoneDiff describes changes between two serials, it's used for IXFR.
+type zoneDiff struct {
+	from    uint32
+	to      uint32
+	removed []dns.RR
+	added   []dns.RR
+}
+
+// zone keeps container records of the zone, that could be transferred
+// to secondaries. Serial is changed on every change of records.
+type zone struct {
+	name string
+	ns   string
+	list func() []dns.RR
+
+	sync.RWMutex
+	serial  uint32
+	records map[string]dns.RR
+	journal []zoneDiff
+}
+
+// watchable is implemented by record stores that could be enumerated.
+type watchable interface {
+	subscribe(func())
+	dump() map[string][]dns.RR
+}
+
+var _ Cacher = (*zone)(nil)
+
+// hostSources returns record stores of hosts, that could be enumerated.
+func hostSources(hosts []*Host) []watchable {
+	var out []watchable
+	for _, host := range hosts {
+		for _, wrk := range host.Workers() {
+			if src, ok := wrk.(watchable); ok {
+				out = append(out, src)
+			}
+		}
+	}
+
+	return out
+}
+
+// dumpSources returns records of every source.
+func dumpSources(sources []watchable) []dns.RR {
+	var out []dns.RR
+	for _, src := range sources {
+		for _, list := range src.dump() {
+			out = append(out, list...)
+		}
+	}
+
+	return out
+}
+
+// newZone creates zone with primary name server ns, ns.<zone> is used when
+// it's empty. Serial continues from the previous one, that was persisted.
+func newZone(name, ns string, serial uint32, list func() []dns.RR) *zone {
+	name = dns.Fqdn(strings.ToLower(name))
+	if ns == "" {
+		ns = "ns." + name
+	}
+
+	return &zone{
+		name: name,
+		ns:   dns.Fqdn(strings.ToLower(ns)),
+		list: list,
+
+		serial:  nextSerial(serial),
+		records: make(map[string]dns.RR),
+	}
+}
+
+// nextSerial returns serial based on time, that keeps it growing across
+// restarts, but never lower than the previous one.
+func nextSerial(prev uint32) uint32 {
+	if now := uint32(time.Now().Unix()); now > prev {
+		return now
+	}
+
+	return prev + 1
+}
+
+// zoneSerial persists serial of the zone, so it's not decreased after restart,
+// when records were changed more often than once a second.
+type zoneSerial struct {
+	path string
+}
+
+func newZoneSerial(dir, zone string) *zoneSerial {
+	if dir == "" {
+		return nil
+	}
+
+	return &zoneSerial{path: filepath.Join(dir, strings.TrimSuffix(strings.ToLower(zone), ".")+".serial")}
+}
+
+// load returns persisted serial, zero when it's unknown.
+func (s *zoneSerial) load() uint32 {
+	if s == nil {
+		return 0
+	}
+
+	buf, err := os.ReadFile(s.path)
+	if err != nil {
+		return 0
+	}
+
+	serial, err := strconv.ParseUint(strings.TrimSpace(string(buf)), 10, 32)
+	if err != nil {
+		return 0
+	}
+
+	return uint32(serial)
+}
+
+// save writes serial atomically, through temporary file.
+func (s *zoneSerial) save(serial uint32) error {
+	if s == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(uint64(serial), 10)), 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+// apex returns NS record of the zone apex, secondaries reject zones without it.
+func (z *zone) apex() *dns.NS {
+	return &dns.NS{
+		Hdr: dns.RR_Header{
+			Name:   z.name,
+			Rrtype: dns.TypeNS,
+			Class:  dns.ClassINET,
+			Ttl:    3600,
+		},
+		Ns: z.ns,
+	}
+}
+
+func (z *zone) soa(serial uint32) *dns.SOA {
+	return &dns.SOA{
+		Hdr: dns.RR_Header{
+			Name:   z.name,
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassINET,
+			Ttl:    60,
+		},
+		Ns:      z.ns,
+		Mbox:    "hostmaster." + z.name,
+		Serial:  serial,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  60,
+	}
+}
+
+func sortRecords(list []dns.RR) []dns.RR {
+	sort.Slice(list, func(i, j int) bool { return list[i].String() < list[j].String() })
+
+	return list
+}
+
+// update reloads records of the zone, returns true when serial was changed.
+func (z *zone) update() bool {
+	current := make(map[string]dns.RR)
+	for _, rr := range z.list() {
+		if !dns.IsSubDomain(z.name, strings.ToLower(rr.Header().Name)) {
+			continue
+		}
+
+		current[rr.String()] = rr
+	}
+
+	z.Lock()
+	defer z.Unlock()
+
+	diff := zoneDiff{from: z.serial}
+	for key, rr := range z.records {
+		if _, ok := current[key]; !ok {
+			diff.removed = append(diff.removed, rr)
+		}
+	}
+
+	for key, rr := range current {
+		if _, ok := z.records[key]; !ok {
+			diff.added = append(diff.added, rr)
+		}
+	}
+
+	if len(diff.removed) == 0 && len(diff.added) == 0 {
+		return false
+	}
+
+	z.serial = nextSerial(z.serial)
+	z.records = current
+
+	diff.to = z.serial
+	diff.added = sortRecords(diff.added)
+	diff.removed = sortRecords(diff.removed)
+
+	if z.journal = append(z.journal, diff); len(z.journal) > zoneJournalSize {
+		z.journal = z.journal[len(z.journal)-zoneJournalSize:]
+	}
+
+	return true
+}
+
+// Serial returns current serial of the zone.
+func (z *zone) Serial() uint32 {
+	z.RLock()
+	defer z.RUnlock()
+
+	return z.serial
+}
+
+// axfr returns full zone, enclosed by SOA records.
+func (z *zone) axfr() []dns.RR {
+	z.RLock()
+	defer z.RUnlock()
+
+	list := make([]dns.RR, 0, len(z.records))
+	for _, rr := range z.records {
+		list = append(list, dns.Copy(rr))
+	}
+
+	soa := z.soa(z.serial)
+
+	out := make([]dns.RR, 0, len(list)+3)
+	out = append(out, soa, z.apex())
+	out = append(out, sortRecords(list)...)
+
+	return append(out, soa)
+}
+
+// ixfr returns incremental transfer from passed serial (RFC 1995),
+// false means that journal has no such serial and AXFR should be used.
+func (z *zone) ixfr(from uint32) ([]dns.RR, bool) {
+	z.RLock()
+	defer z.RUnlock()
+
+	current := z.soa(z.serial)
+	if from == z.serial {
+		return []dns.RR{current}, true
+	}
+
+	start := -1
+	for i, diff := range z.journal {
+		if diff.from == from {
+			start = i
+
+			break
+		}
+	}
+
+	if start < 0 {
+		return nil, false
+	}
+
+	out := []dns.RR{current}
+	for _, diff := range z.journal[start:] {
+		out = append(out, z.soa(diff.from))
+		out = append(out, diff.removed...)
+		out = append(out, z.soa(diff.to))
+		out = append(out, diff.added...)
+	}
+
+	return append(out, current), true
+}
+
+// Get answers SOA and NS queries for the zone apex.
+func (z *zone) Get(query dns.Question) ([]dns.RR, error) {
+	if !strings.EqualFold(query.Name, z.name) {
+		return nil, ErrNotFound
+	}
+
+	switch query.Qtype {
+	case dns.TypeSOA:
+		return []dns.RR{z.soa(z.Serial())}, nil
+	case dns.TypeNS:
+		return []dns.RR{z.apex()}, nil
+	default:
+		return nil, ErrNotFound
+	}
+}
+
+func (z *zone) Set(_ dns.Question, _ string, _ []dns.RR) {}
@@ -0,0 +1,84 @@
+package dns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestNextSerial(t *testing.T) {
+	now := uint32(time.Now().Unix())
+
+	cases := []struct {
+		name string
+		prev uint32
+		min  uint32
+		max  uint32
+	}{
+		{name: "empty", prev: 0, min: now, max: now + 5},
+		{name: "past", prev: now - 3600, min: now, max: now + 5},
+		{name: "ahead", prev: now + 3600, min: now + 3601, max: now + 3601},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := nextSerial(tc.prev); got < tc.min || got > tc.max {
+				t.Fatalf("expected serial in [%d, %d], got %d", tc.min, tc.max, got)
+			}
+		})
+	}
+}
+
+func TestZoneApex(t *testing.T) {
+	records := []dns.RR{testA("web.docker.lan.", "10.0.0.1"), testA("web.other.lan.", "10.0.0.2")}
+
+	prev := uint32(time.Now().Unix()) + 3600
+	z := newZone("Docker.LAN", "", prev, func() []dns.RR { return records })
+
+	if !z.update() {
+		t.Fatal("expected zone to be changed")
+	} else if z.Serial() <= prev {
+		t.Fatalf("expected serial greater than %d, got %d", prev, z.Serial())
+	}
+
+	out := z.axfr()
+	if len(out) != 4 {
+		t.Fatalf("expected SOA, NS, A, SOA, got %v", out)
+	}
+
+	if soa, ok := out[0].(*dns.SOA); !ok || soa.Ns != "ns.docker.lan." {
+		t.Fatalf("expected SOA, got %v", out[0])
+	} else if ns, ok := out[1].(*dns.NS); !ok || ns.Hdr.Name != "docker.lan." || ns.Ns != soa.Ns {
+		t.Fatalf("expected apex NS, got %v", out[1])
+	}
+
+	rec, err := z.Get(testQuestion("docker.lan.", dns.TypeNS))
+	if err != nil || len(rec) != 1 {
+		t.Fatalf("expected apex NS, got %v (%v)", rec, err)
+	}
+
+	if z.update() {
+		t.Fatal("expected zone without changes")
+	}
+}
+
+func TestZoneSerialPersist(t *testing.T) {
+	ser := newZoneSerial(t.TempDir(), "docker.lan.")
+	if got := ser.load(); got != 0 {
+		t.Fatalf("expected unknown serial, got %d", got)
+	}
+
+	if err := ser.save(4000000000); err != nil {
+		t.Fatal(err)
+	}
+
+	z := newZone("docker.lan", "ns1.example.com", ser.load(), func() []dns.RR { return nil })
+	if z.Serial() != 4000000001 {
+		t.Fatalf("expected serial to continue from persisted one, got %d", z.Serial())
+	}
+
+	if soa := z.soa(z.Serial()); soa.Ns != "ns1.example.com." {
+		t.Fatalf("expected configured primary NS, got %s", soa.Ns)
+	}
+}